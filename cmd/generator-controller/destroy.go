@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/changeset"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/chart"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/routes"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+const destroyUsage = `Removes a controller that was scaffolded by the generator.
+
+This removes the controller's deployment and service templates, its block in values.yaml, its
+name template in _helpers.tpl, its route in config/routes and its source directory. If the
+source directory existed before the controller was generated, only the files generated in it
+are removed, and without a generation record it is left in place.
+
+If the generated files were modified since the controller was generated, destroy refuses to
+remove them unless --force is given.
+`
+
+type destroyCmd struct {
+	stdout io.Writer
+	name   string
+	force  bool
+	dryRun bool
+
+	// fsys is the file system holding the project. It defaults to vfs.OS.
+	fsys vfs.FS
+}
+
+func newDestroyCmd(stdout io.Writer) *cobra.Command {
+	c := &destroyCmd{
+		stdout: stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "destroy <name>",
+		Short: "removes a generated controller",
+		Long:  destroyUsage,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c.name = args[0]
+			return c.run()
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&c.force, "force", "f", false, "remove the controller even if its source directory was modified since it was generated")
+	f.BoolVar(&c.dryRun, "dry-run", false, "print the changes that would be made to the project as a unified diff instead of writing them")
+
+	return cmd
+}
+
+func (c *destroyCmd) run() error {
+	if err := validateName(c.name); err != nil {
+		return err
+	}
+	fsys := projectFS(c.fsys)
+	appConfig, err := loadAppConfig(fsys)
+	if err != nil {
+		return err
+	}
+
+	record, err := loadRecord(fsys, c.name)
+	if err != nil {
+		return err
+	}
+	if record == nil && !c.force {
+		return fmt.Errorf("no generation record found for controller %s at %s, refusing to remove it. Use --force to remove it anyway", c.name, recordPath(c.name))
+	}
+	if record != nil && !c.force {
+		modified, err := record.modified(fsys, c.name)
+		if err != nil {
+			return err
+		}
+		if len(modified) > 0 {
+			return fmt.Errorf("the source directory of controller %s was modified since it was generated: %s. Use --force to remove it anyway", c.name, strings.Join(modified, ", "))
+		}
+	}
+
+	cs := changeset.NewFS(fsys)
+	chartDir := filepath.Join("charts", appConfig.Name)
+
+	for _, path := range []string{
+		filepath.Join(chartDir, "templates", fmt.Sprintf("%s-deployment.yaml", c.name)),
+		filepath.Join(chartDir, "templates", fmt.Sprintf("%s-service.yaml", c.name)),
+		recordPath(c.name),
+	} {
+		if err := cs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	edits := []struct {
+		path   string
+		remove func([]byte) ([]byte, error)
+	}{
+		{filepath.Join(chartDir, "values.yaml"), func(b []byte) ([]byte, error) {
+			return chart.RemoveValues(b, c.name), nil
+		}},
+		{filepath.Join(chartDir, "templates", "_helpers.tpl"), func(b []byte) ([]byte, error) {
+			return chart.RemoveDefine(b, fmt.Sprintf("%s.%s.name", appConfig.Name, c.name))
+		}},
+		{filepath.Join("config", "routes"), func(b []byte) ([]byte, error) {
+			return removeRoute(b, record, c.name)
+		}},
+	}
+	for _, e := range edits {
+		b, err := cs.ReadFile(e.path)
+		if os.IsNotExist(err) {
+			log.Debugf("%s does not exist, skipping", e.path)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if b, err = e.remove(b); err != nil {
+			return fmt.Errorf("could not update %s: %v", e.path, err)
+		}
+		if err := cs.WriteFile(e.path, b, 0644); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case record == nil:
+		log.Debugf("no generation record for controller %s, leaving %s in place", c.name, c.name)
+	case record.CreatedDir:
+		if _, err := fsys.Stat(c.name); err == nil {
+			if err := cs.RemoveAll(c.name); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("there was an error checking if %s exists: %v", c.name, err)
+		}
+	default:
+		// the directory existed before the controller was generated
+		for relPath := range record.Files {
+			if record.isBackup(relPath) {
+				continue
+			}
+			path := filepath.Join(c.name, filepath.FromSlash(relPath))
+			if err := cs.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	// the directory of the generation records goes with the last of them
+	staged := cs.FS()
+	if entries, err := staged.ReadDir(recordsDir); err == nil && len(entries) == 0 {
+		if err := staged.Remove(recordsDir); err != nil {
+			return err
+		}
+	}
+
+	if c.dryRun {
+		return cs.Diff(c.stdout)
+	}
+	if err := cs.Apply(); err != nil {
+		return fmt.Errorf("could not remove controller %s: %v", c.name, err)
+	}
+
+	fmt.Fprintf(c.stdout, "--> Removed controller %s\n", c.name)
+	return nil
+}
+
+// removeRoute removes the route recorded for the named controller from the routes file content.
+// Without a record, the route the generator adds for the controller is removed instead.
+func removeRoute(content []byte, record *controllerRecord, name string) ([]byte, error) {
+	f, err := routes.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		f.Remove(func(r routes.Route) bool { return record.Route != "" && r.String() == record.Route })
+	} else {
+		f.Remove(func(r routes.Route) bool { return r.Path == "/"+name+"/" && r.Backend == name })
+	}
+	return f.Bytes(), nil
+}
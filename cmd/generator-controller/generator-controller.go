@@ -1,28 +1,48 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
 
 	"github.com/BurntSushi/toml"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/bacongobbler/kubed-generator-controller/packs"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/changeset"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/chart"
 	"github.com/bacongobbler/kubed-generator-controller/pkg/manifest"
 	"github.com/bacongobbler/kubed-generator-controller/pkg/pack"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/routes"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
 const (
 	environmentEnvVar = "KUBED_ENV"
-	globalUsage       = `Generates boilerplate code that is necessary to write a microservice.
+	// repoPrecedenceEnvVar is the default of --repo-precedence, as a comma-separated list.
+	repoPrecedenceEnvVar = "KUBED_PACK_REPO_PRECEDENCE"
+	// defaultPack is the pack used when --pack is omitted and no pack is detected.
+	defaultPack = "nodejs"
+	globalUsage = `Generates boilerplate code that is necessary to write a microservice.
 
 By default it scaffolds your application using the javascript pack, but it can be changed using the --pack flag.
-See 'kubed generate controller --help' to see what packs are available.
+See 'generator-controller packs list' to see what packs are available.
+
+If the controller's directory already has source and --pack is omitted, or if --detect is
+given, the pack is chosen by detecting the language of that source. Use --debug to see how
+confident the detection is.
+
+Packs may accept variables, declared in their pack.toml, which are set with --set, --set-string
+and --values. They are available to the pack's templates and to the chart templates as .Vars.
 `
 	deploymentTemplate = `kind: Deployment
 apiVersion: apps/v1
@@ -51,8 +71,21 @@ spec:
           imagePullPolicy: {{ default .Values.{% .Name %}.image.pullPolicy "IfNotPresent" }}
           ports:
             - name: http
-              containerPort: 8080
+              containerPort: {% .Port %}
               protocol: TCP
+          env:
+            - name: PORT
+              value: "{% .Port %}"
+{%- if .HealthCheckPath %}
+          readinessProbe:
+            httpGet:
+              path: {% yaml .HealthCheckPath %}
+              port: http
+          livenessProbe:
+            httpGet:
+              path: {% yaml .HealthCheckPath %}
+              port: http
+{%- end %}
 `
 	serviceTemplate = `kind: Service
 apiVersion: v1
@@ -67,7 +100,7 @@ spec:
     controller: {% .Name %}
   ports:
     - port: 80
-      targetPort: http
+      targetPort: {% .Port %}
       protocol: TCP
       name: http
 `
@@ -78,22 +111,76 @@ spec:
 `
 	valuesTemplate = `
 {% .Name %}:
+{%- with .Vars.replicaCount %}
+  replicaCount: {% yaml . %}
+{%- end %}
   image: {}
 `
 )
 
 var flagDebug bool
 
+// chartValues are the values the chart templates are rendered with.
+type chartValues struct {
+	AppName         string
+	Name            string
+	Port            int
+	HealthCheckPath string
+	// Vars are the values of the variables the pack accepts. A replicaCount variable sets the
+	// controller's replica count in values.yaml.
+	Vars map[string]interface{}
+}
+
+// renderChartTemplate renders one of the chart templates with values. Values coming from the
+// user or the pack are written with the yaml function, so that they are read back as they are.
+func renderChartTemplate(tpl string, values chartValues) ([]byte, error) {
+	t := template.Must(template.New("chart").Delims("{%", "%}").Funcs(template.FuncMap{"yaml": yamlScalar}).Parse(tpl))
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlScalar writes v as a YAML flow scalar: strings are double-quoted and escaped, and other
+// values are written as JSON, which YAML reads as it is.
+func yamlScalar(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
 type generateCmd struct {
-	stdout         io.Writer
-	pack           string
-	name           string
-	repositoryName string
+	stdout          io.Writer
+	pack            string
+	name            string
+	repositoryName  string
+	dryRun          bool
+	force           bool
+	port            int
+	noRoute         bool
+	createRoutes    bool
+	repoPrecedence  []string
+	detect          bool
+	overwrite       string
+	stdin           io.Reader
+	stdinReader     *bufio.Reader
+	setValues       []string
+	setStringValues []string
+	valuesFiles     []string
+
+	// fsys is the file system holding the project and the packs. It defaults to vfs.OS.
+	fsys vfs.FS
 }
 
 func newRootCmd(stdout io.Writer, stdin io.Reader, stderr io.Writer) *cobra.Command {
 	c := generateCmd{
 		stdout: stdout,
+		stdin:  stdin,
 	}
 
 	cmd := &cobra.Command{
@@ -106,173 +193,439 @@ func newRootCmd(stdout io.Writer, stdin io.Reader, stderr io.Writer) *cobra.Comm
 			if flagDebug {
 				log.SetLevel(log.DebugLevel)
 			}
-			c.name = args[0]
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			c.name = args[0]
 			return c.run()
 		},
 	}
 
 	f := cmd.Flags()
-	f.StringVarP(&c.pack, "pack", "p", "nodejs", "the named starter pack to scaffold the controller with. Default starter packs: [clojure dotnet go maven nodejs php python ruby rust swift]")
+	f.StringVar(&c.overwrite, "overwrite", string(pack.Skip), "what to do with pack files that already exist in the controller's directory: skip, overwrite, backup (to <file>.bak, then overwrite), merge-prompt (ask for each file, or list them with --dry-run) or fail")
+	f.BoolVar(&c.detect, "detect", false, "choose the pack by detecting the language of the source in the controller's directory")
+	f.StringVarP(&c.pack, "pack", "p", "", "the named starter pack to scaffold the controller with. Run 'generator-controller packs list' to list the available packs. Defaults to "+defaultPack)
+	f.BoolVar(&c.dryRun, "dry-run", false, "print the changes that would be made to the project as a unified diff instead of writing them")
+	f.BoolVarP(&c.force, "force", "f", false, "add the controller's route even if it conflicts with existing routes")
+	f.BoolVar(&c.noRoute, "no-route", false, "do not add a route to config/routes, for controllers that are only reachable from inside the cluster")
+	f.BoolVar(&c.createRoutes, "create-routes", false, "create config/routes with the default static route if it does not exist")
+	f.IntVar(&c.port, "port", 0, fmt.Sprintf("the port the controller listens on. Defaults to the port declared by the pack, or %d", pack.DefaultPort))
+	f.StringArrayVar(&c.setValues, "set", nil, "set a variable the pack accepts, as key=value. The value is parsed according to the variable's type. Can be given several times")
+	f.StringArrayVar(&c.setStringValues, "set-string", nil, "set a string variable the pack accepts, as key=value. Can be given several times")
+	f.StringArrayVar(&c.valuesFiles, "values", nil, "set the variables the pack accepts from a YAML file. Can be given several times")
+	f.StringSliceVar(&c.repoPrecedence, "repo-precedence", defaultRepoPrecedence(), fmt.Sprintf("the pack repositories to use, in order, when several have a pack with the same name. Defaults to $%s", repoPrecedenceEnvVar))
 
 	pf := cmd.PersistentFlags()
 	pf.BoolVar(&flagDebug, "debug", false, "enable verbose output")
 
+	cmd.AddCommand(
+		newDestroyCmd(stdout),
+		newPacksCmd(stdout),
+		newPackRepoCmd(stdout),
+	)
+
 	return cmd
 }
 
 func (c *generateCmd) run() error {
-	// --pack was explicitly defined, so we can just lazily use that here. No detection required.
-	// if KUBED_PLUGIN_DIR is unset, we just fallback to ./packs
-	packsFound, err := pack.Find(filepath.Join(os.Getenv("KUBED_PLUGIN_DIR"), "packs"), c.pack)
-	if err != nil {
+	if err := validateName(c.name); err != nil {
 		return err
 	}
-
-	var config manifest.Manifest
-	if _, err := toml.DecodeFile(filepath.Join("config", "kubed.toml"), &config); err != nil {
+	fsys := c.filesystem()
+	if err := c.choosePack(); err != nil {
 		return err
 	}
-	appConfig, found := config.Environments[defaultEnvironment()]
-	if !found {
-		return fmt.Errorf("Environment %v not found", defaultEnvironment())
+	packsFound, err := pack.FindFS(fsys, packsDir(), c.pack)
+	if err != nil {
+		return err
+	}
+	log.Debugf("packs found: %v", packsFound)
+	if len(packsFound) == 0 {
+		return fmt.Errorf("No packs found with name %s", c.pack)
+	}
+	packSrc := packsFound[0]
+	if len(packsFound) > 1 {
+		var ok bool
+		packSrc, ok = pack.Select(packsDir(), packsFound, c.repoPrecedence)
+		if !ok {
+			return fmt.Errorf("Multiple packs named %s found: %v\nQualify the pack with its repository, e.g. <repository>/%s, or set the repository precedence with --repo-precedence", c.pack, packsFound, c.pack)
+		}
+		log.Debugf("using pack %s from the repository with the highest precedence", packSrc)
 	}
 
-	deploymentFile, err := os.Create(filepath.Join("charts", appConfig.Name, "templates", fmt.Sprintf("%s-deployment.yaml", c.name)))
+	packMetadata, err := pack.LoadMetadataFS(fsys, packSrc)
 	if err != nil {
 		return err
 	}
-	defer deploymentFile.Close()
-	serviceFile, err := os.Create(filepath.Join("charts", appConfig.Name, "templates", fmt.Sprintf("%s-service.yaml", c.name)))
+	port, err := c.resolvePort(packSrc, packMetadata)
 	if err != nil {
 		return err
 	}
-	defer serviceFile.Close()
-	valuesFile, err := os.OpenFile(filepath.Join("charts", appConfig.Name, "values.yaml"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	given, err := c.variables()
 	if err != nil {
 		return err
 	}
-	defer valuesFile.Close()
-	helpersFile, err := os.OpenFile(filepath.Join("charts", appConfig.Name, "templates", "_helpers.tpl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	vars, err := packMetadata.ResolveVariables(given)
+	if err != nil {
+		return fmt.Errorf("pack %s: %v", c.pack, err)
+	}
+
+	appConfig, err := loadAppConfig(fsys)
 	if err != nil {
 		return err
 	}
-	defer helpersFile.Close()
+
+	cs := changeset.NewFS(fsys)
 
 	// scaffold helm chart
-	values := struct {
-		AppName string
-		Name    string
+	values := chartValues{
+		AppName:         appConfig.Name,
+		Name:            c.name,
+		Port:            port,
+		HealthCheckPath: packMetadata.HealthCheckPath,
+		Vars:            vars,
+	}
+	chartDir := filepath.Join("charts", appConfig.Name)
+	chartFiles := []struct {
+		path  string
+		tpl   string
+		merge func(content, rendered []byte) ([]byte, error)
 	}{
-		AppName: appConfig.Name,
-		Name:    c.name,
+		{filepath.Join(chartDir, "templates", fmt.Sprintf("%s-deployment.yaml", c.name)), deploymentTemplate, nil},
+		{filepath.Join(chartDir, "templates", fmt.Sprintf("%s-service.yaml", c.name)), serviceTemplate, nil},
+		{filepath.Join(chartDir, "values.yaml"), valuesTemplate, chart.MergeValues},
+		{filepath.Join(chartDir, "templates", "_helpers.tpl"), helperTemplate, chart.MergeHelpers},
 	}
-	dt := template.Must(template.New("deployment").Delims("{%", "%}").Parse(deploymentTemplate))
-	if err := dt.Execute(deploymentFile, values); err != nil {
-		return err
+	for _, f := range chartFiles {
+		b, err := renderChartTemplate(f.tpl, values)
+		if err != nil {
+			return err
+		}
+		if f.merge != nil {
+			content, err := cs.ReadFile(f.path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if b, err = f.merge(content, b); err != nil {
+				return fmt.Errorf("could not update %s: %v", f.path, err)
+			}
+		}
+		if err := cs.WriteFile(f.path, b, 0644); err != nil {
+			return err
+		}
 	}
 
-	st := template.Must(template.New("service").Delims("{%", "%}").Parse(serviceTemplate))
-	if err := st.Execute(serviceFile, values); err != nil {
-		return err
+	// scaffold business logic
+	_, err = fsys.Stat(c.name)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("there was an error checking if %s exists: %v", c.name, err)
 	}
-
-	vt := template.Must(template.New("values").Delims("{%", "%}").Parse(valuesTemplate))
-	if err := vt.Execute(valuesFile, values); err != nil {
+	createdDir := os.IsNotExist(err)
+	cs.MkdirAll(c.name, 0777)
+	policy := pack.Skip
+	if c.overwrite != "" {
+		if policy, err = pack.ParseOverwritePolicy(c.overwrite); err != nil {
+			return err
+		}
+	}
+	opts := pack.SaveOptions{Policy: policy, Prompt: c.prompt}
+	var unresolved []string
+	if c.dryRun && policy == pack.MergePrompt {
+		// a dry run does not ask anything, so existing files are left out of the diff
+		opts.Prompt = func(path string, existing, incoming []byte) (pack.OverwritePolicy, error) {
+			unresolved = append(unresolved, path)
+			return pack.Skip, nil
+		}
+	}
+	packReport, err := stagePack(fsys, cs, c.name, packSrc, pack.TemplateValues{
+		Name:            c.name,
+		AppName:         appConfig.Name,
+		Port:            port,
+		EnvironmentName: defaultEnvironment(),
+		Environment:     appConfig,
+		Vars:            vars,
+	}, opts)
+	if err != nil {
 		return err
 	}
 
-	ht := template.Must(template.New("helpers").Delims("{%", "%}").Parse(helperTemplate))
-	if err := ht.Execute(helpersFile, values); err != nil {
+	record := &controllerRecord{
+		Pack:       c.pack,
+		CreatedDir: createdDir,
+		Files:      make(map[string]string),
+	}
+	if !c.noRoute {
+		route := routes.Route{
+			Path:    fmt.Sprintf("/%s/", c.name),
+			Backend: c.name,
+			Port:    port,
+		}
+		if err := c.stageRoute(cs, route); err != nil {
+			return err
+		}
+		record.Route = route.String()
+	}
+	// keep track of the files generated by an earlier run, which the pack leaves untouched
+	previous, err := loadRecord(fsys, c.name)
+	if err != nil {
 		return err
 	}
-
-	// scaffold business logic
-	if _, err := os.Stat(c.name); os.IsNotExist(err) {
-		if err := os.Mkdir(c.name, 0777); err != nil {
+	if previous != nil {
+		record.CreatedDir = record.CreatedDir || previous.CreatedDir
+		for relPath, sum := range previous.Files {
+			record.Files[relPath] = sum
+		}
+		record.Backups = append(record.Backups, previous.Backups...)
+	}
+	staged := cs.FS()
+	var generated []string
+	for _, paths := range [][]string{packReport.Created, packReport.Overwritten, packReport.Unchanged, packReport.Backups} {
+		generated = append(generated, paths...)
+	}
+	for _, path := range generated {
+		fi, err := staged.Lstat(path)
+		if err != nil {
 			return err
 		}
-	} else if err != nil {
-		return fmt.Errorf("there was an error checking if %s exists: %v", c.name, err)
+		sum, err := checksumFile(staged, path, fi)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(c.name, path)
+		if err != nil {
+			return err
+		}
+		record.Files[filepath.ToSlash(relPath)] = sum
 	}
-	log.Debugf("packs found: %v", packsFound)
-	if len(packsFound) == 0 {
-		return fmt.Errorf("No packs found with name %s", c.pack)
-
-	} else if len(packsFound) == 1 {
-		packSrc := packsFound[0]
-		if err = pack.CreateFrom(c.name, packSrc); err != nil {
+	for _, path := range packReport.Backups {
+		relPath, err := filepath.Rel(c.name, path)
+		if err != nil {
 			return err
 		}
-
-	} else {
-		return fmt.Errorf("Multiple packs named %s found: %v", c.pack, packsFound)
+		record.Backups = append(record.Backups, filepath.ToSlash(relPath))
+	}
+	if err := stageRecord(cs, c.name, record); err != nil {
+		return err
 	}
 
-	// Each pack makes the assumption that they're listening on port 8080
-	addRoute(filepath.Join("config", "routes"), fmt.Sprintf("/%s/\t%s\t8080", c.name, c.name))
+	if c.dryRun {
+		if err := cs.Diff(c.stdout); err != nil {
+			return err
+		}
+		for _, path := range unresolved {
+			fmt.Fprintf(c.stdout, "--> %s already exists and would be prompted for\n", path)
+		}
+		return nil
+	}
+	// nothing was written up to this point, and Apply restores the project if it fails halfway
+	if err := cs.Apply(); err != nil {
+		return fmt.Errorf("could not scaffold controller %s: %v", c.name, err)
+	}
 
+	packReport.Print(c.stdout)
+	if len(packReport.Skipped) > 0 {
+		fmt.Fprintln(c.stdout, "--> Existing files were left untouched. Use --overwrite to replace them")
+	}
 	fmt.Fprintln(c.stdout, "--> Ready to sail")
 	return nil
 }
 
-// addRoute adds a new route to fpath. It appends the route
-// above the default route so that it takes higher priority
-// in the list than the static files, but lower priority than
-// other routes higher up in the list.
-func addRoute(fpath, route string) error {
-	const defaultRoute = "/\tstatic\t"
-	b, err := ioutil.ReadFile(fpath)
+// choosePack sets the pack to scaffold the controller with when --pack was omitted: the pack
+// detected in the controller's directory if --detect was given or the directory already has
+// source, or else defaultPack.
+func (c *generateCmd) choosePack() error {
+	if c.detect && c.pack != "" {
+		return errors.New("--detect and --pack cannot be used together")
+	}
+	if c.pack != "" {
+		// --pack was explicitly defined, so we can just lazily use that here. No detection required.
+		return nil
+	}
+	fsys := c.filesystem()
+	if !c.detect && !hasSource(fsys, c.name) {
+		c.pack = defaultPack
+		return nil
+	}
+
+	detections, err := pack.DetectFS(fsys, packsDir(), c.name, c.repoPrecedence)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not detect the pack for %s: %v", c.name, err)
 	}
-	content := string(b)
-	fileContent := ""
-	n, defaultRouteExists := containsDefaultRoute(content)
-	if defaultRouteExists {
-		for i, line := range strings.Split(content, "\n") {
-			if i == n {
-				fileContent += route + "\n"
-			}
-			fileContent += line + "\n"
-		}
-	} else {
-		fileContent = content
-		if !strings.HasSuffix(fileContent, "\n") && fileContent != "" {
-			fileContent += "\n"
+	for _, d := range detections {
+		log.Debugf("detected pack %s with confidence %.2f (matched %s)", d.Reference(), d.Confidence, strings.Join(d.Matched, ", "))
+	}
+	if len(detections) == 0 {
+		return fmt.Errorf("could not detect the language of %s. Use --pack to choose a pack", c.name)
+	}
+	c.pack = detections[0].Reference()
+	if !c.dryRun {
+		fmt.Fprintf(c.stdout, "--> Detected pack %s\n", c.pack)
+	}
+	return nil
+}
+
+// hasSource reports whether dir exists in fsys and holds files.
+func hasSource(fsys vfs.FS, dir string) bool {
+	entries, err := fsys.ReadDir(dir)
+	return err == nil && len(entries) > 0
+}
+
+// validateName returns an error if name cannot be the name of a controller. The controller's
+// source directory is at the top of the project, so the name must be a single path element.
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.IsAbs(name) || strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return fmt.Errorf("invalid controller name %q: it must be the name of a directory at the top of the project", name)
+	}
+	return nil
+}
+
+// resolvePort returns the port the controller listens on: the one given with --port, or else
+// the pack's default port from its metadata or its Dockerfile, or else pack.DefaultPort.
+func (c *generateCmd) resolvePort(packSrc string, metadata *pack.Metadata) (int, error) {
+	if c.port != 0 {
+		if c.port < 1 || c.port > 65535 {
+			return 0, fmt.Errorf("invalid port %d", c.port)
 		}
-		fileContent += route + "\n"
+		return c.port, nil
+	}
+	if metadata.Port != 0 {
+		return metadata.Port, nil
+	}
+	port, err := pack.ExposedPortFS(c.filesystem(), packSrc)
+	if err != nil {
+		return 0, fmt.Errorf("could not read the port exposed by pack %s: %v", c.pack, err)
+	}
+	if port == 0 {
+		log.Debugf("pack %s does not declare a port, using %d", c.pack, pack.DefaultPort)
+		return pack.DefaultPort, nil
 	}
-	return ioutil.WriteFile(fpath, []byte(fileContent), 0644)
+	return port, nil
 }
 
-// containsDefaultRoute determines if the content contains a line starting with
+// stagePack stages the files of the pack at src in fsys to be written to dest, rendering its
+// templates with values. Files that already exist in dest are handled as set by opts, as with
+// pack.Save.
 //
-// / static 8080 /
-//
-// if it does, it returns the line number (0-indexed) where the first instance
-// of that route is found.
-func containsDefaultRoute(content string) (int, bool) {
-	for i, line := range strings.Split(content, "\n") {
-		fields := strings.Fields(line)
-		if len(fields) >= 4 {
-			if fields[0] == "/" && fields[1] == "static" &&
-				fields[2] == "8080" && fields[3] == "/" {
-				return i, true
+// It returns what was staged for each file of the pack.
+func stagePack(fsys vfs.FS, cs *changeset.Changeset, dest, src string, values pack.TemplateValues, opts pack.SaveOptions) (*pack.SaveReport, error) {
+	p, err := pack.FromFS(fsys, src)
+	if err != nil {
+		return nil, fmt.Errorf("could not load pack: %s\nTry running:\n\t$ generator-controller pack-repo update", err)
+	}
+	if err := p.Render(values); err != nil {
+		return nil, err
+	}
+	return p.SaveFS(cs.FS(), dest, opts)
+}
+
+// prompt asks the user what to do with a pack file that already exists, for the merge-prompt
+// overwrite policy.
+func (c *generateCmd) prompt(path string, existing, incoming []byte) (pack.OverwritePolicy, error) {
+	if c.stdinReader == nil {
+		c.stdinReader = bufio.NewReader(c.stdin)
+	}
+	for {
+		fmt.Fprintf(c.stdout, "%s already exists. [s]kip, [o]verwrite, [b]ackup and overwrite, or show [d]iff? ", path)
+		answer, err := c.stdinReader.ReadString('\n')
+		if err != nil && answer == "" {
+			return "", fmt.Errorf("could not read what to do with %s: %v", path, err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "s", "skip":
+			return pack.Skip, nil
+		case "o", "overwrite":
+			return pack.Overwrite, nil
+		case "b", "backup":
+			return pack.Backup, nil
+		case "d", "diff":
+			change := &changeset.Change{Path: path, Before: existing, After: incoming}
+			if err := change.Diff(c.stdout); err != nil {
+				return "", err
 			}
 		}
 	}
-	return 0, false
+}
+
+// stageRoute adds the controller's route to config/routes, above the default route.
+func (c *generateCmd) stageRoute(cs *changeset.Changeset, route routes.Route) error {
+	fpath := filepath.Join("config", "routes")
+	f := new(routes.File)
+	b, err := cs.ReadFile(fpath)
+	switch {
+	case os.IsNotExist(err):
+		if !c.createRoutes {
+			return fmt.Errorf("%s does not exist. Use --create-routes to create it, or --no-route to scaffold a controller without a route", fpath)
+		}
+		f.Add(routes.StaticRoute)
+	case err != nil:
+		return fmt.Errorf("could not read %s: %v", fpath, err)
+	default:
+		if f, err = routes.Parse(b); err != nil {
+			return fmt.Errorf("could not parse %s: %v", fpath, err)
+		}
+	}
+
+	if f.Contains(route) {
+		log.Debugf("%s already has route %s", fpath, route)
+		return nil
+	}
+	if conflicts := f.Conflicts(route); len(conflicts) > 0 && !c.force {
+		err := &routes.ConflictError{File: fpath, Route: route, Conflicts: conflicts}
+		return fmt.Errorf("%v\nUse --force to add the route anyway", err)
+	}
+	f.Add(route)
+	return cs.WriteFile(fpath, f.Bytes(), 0644)
 }
 
 func main() {
+	repo.Builtin = packs.FS
 	cmd := newRootCmd(os.Stdout, os.Stdin, os.Stderr)
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+// loadAppConfig loads the configuration of the app for the current environment from
+// config/kubed.toml in fsys.
+func loadAppConfig(fsys vfs.FS) (*manifest.Environment, error) {
+	var config manifest.Manifest
+	b, err := fsys.ReadFile(filepath.Join("config", "kubed.toml"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := toml.Decode(string(b), &config); err != nil {
+		return nil, err
+	}
+	appConfig, found := config.Environments[defaultEnvironment()]
+	if !found {
+		return nil, fmt.Errorf("Environment %v not found", defaultEnvironment())
+	}
+	return appConfig, nil
+}
+
+// filesystem returns the file system holding the project and the packs, including the bundled
+// ones.
+func (c *generateCmd) filesystem() vfs.FS {
+	return repo.WithBuiltin(projectFS(c.fsys), packsDir())
+}
+
+// projectFS returns fsys, or vfs.OS if it is nil.
+func projectFS(fsys vfs.FS) vfs.FS {
+	if fsys == nil {
+		return vfs.OS
+	}
+	return fsys
+}
+
+func defaultRepoPrecedence() []string {
+	var precedence []string
+	for _, name := range strings.Split(os.Getenv(repoPrecedenceEnvVar), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			precedence = append(precedence, name)
+		}
+	}
+	return precedence
+}
+
 func defaultEnvironment() string {
 	env := os.Getenv(environmentEnvVar)
 	if env == "" {
@@ -0,0 +1,805 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/bacongobbler/kubed-generator-controller/packs"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+const (
+	testKubedToml = `[environments.development]
+name = "myapp"
+`
+	testValues  = "buildID: 1\n"
+	testHelpers = `{{- define "myapp.name" -}}
+{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+`
+	testRoutes = "/api/\tapi\t8080\n/\tstatic\t8080\t/\n"
+)
+
+// newTestProject creates a kubed project in a temporary directory and changes into it. The
+// returned function changes back to the previous working directory and removes the project.
+func newTestProject(t *testing.T) func() {
+	plugin, err := filepath.Abs(filepath.Join("testdata", "plugin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "generator-controller-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join("config", "kubed.toml"):                         testKubedToml,
+		filepath.Join("config", "routes"):                             testRoutes,
+		filepath.Join("charts", "myapp", "values.yaml"):               testValues,
+		filepath.Join("charts", "myapp", "templates", "_helpers.tpl"): testHelpers,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("KUBED_PLUGIN_DIR", plugin)
+	return func() {
+		os.Unsetenv("KUBED_PLUGIN_DIR")
+		os.Chdir(cwd)
+		os.RemoveAll(dir)
+	}
+}
+
+// snapshot returns the content of every file under the current directory.
+func snapshot(t *testing.T) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(".", func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		files[path] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func assertUnchanged(t *testing.T, before map[string]string) {
+	after := snapshot(t)
+	if len(after) != len(before) {
+		t.Errorf("expected %d files in the project, got %d: %v", len(before), len(after), after)
+	}
+	for path, content := range before {
+		if after[path] != content {
+			t.Errorf("expected %s to be unchanged, got %q", path, after[path])
+		}
+	}
+	if _, err := os.Stat("foo"); !os.IsNotExist(err) {
+		t.Errorf("expected controller directory to not exist, got %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	defer newTestProject(t)()
+
+	out := new(bytes.Buffer)
+	c := &generateCmd{stdout: out, name: "foo", pack: "test"}
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		filepath.Join("charts", "myapp", "templates", "foo-deployment.yaml"),
+		filepath.Join("charts", "myapp", "templates", "foo-service.yaml"),
+		filepath.Join("foo", "Dockerfile"),
+		filepath.Join("foo", "hello.txt"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be created, got %v", path, err)
+		}
+	}
+	routes, err := ioutil.ReadFile(filepath.Join("config", "routes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(routes), "/foo/\tfoo\t8080\n/\tstatic") {
+		t.Errorf("expected route to be added above the default route, got %q", routes)
+	}
+
+	greeting, err := ioutil.ReadFile(filepath.Join("foo", "greeting.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "foo is part of myapp and listens on port 8080 in development\n"; string(greeting) != want {
+		t.Errorf("expected the pack template to be rendered as %q, got %q", want, greeting)
+	}
+	if _, err := os.Stat(filepath.Join("foo", "greeting.txt.tmpl")); !os.IsNotExist(err) {
+		t.Errorf("expected the pack template not to be copied, got %v", err)
+	}
+
+	if fi, err := os.Stat(filepath.Join("foo", "run.sh")); err != nil || fi.Mode()&0111 == 0 {
+		t.Errorf("expected run.sh to be created executable, got %v, %v", fi, err)
+	}
+	if target, err := os.Readlink(filepath.Join("foo", "start.sh")); err != nil || target != "run.sh" {
+		t.Errorf("expected start.sh to be created as a symlink to run.sh, got %q, %v", target, err)
+	}
+}
+
+func TestGenerateDryRun(t *testing.T) {
+	defer newTestProject(t)()
+	before := snapshot(t)
+
+	out := new(bytes.Buffer)
+	c := &generateCmd{stdout: out, name: "foo", pack: "test", dryRun: true}
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+	assertUnchanged(t, before)
+
+	for _, want := range []string{
+		"+++ b/charts/myapp/templates/foo-deployment.yaml",
+		"+++ b/charts/myapp/values.yaml",
+		"+++ b/foo/hello.txt",
+		"+/foo/\tfoo\t8080",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected dry run output to contain %q, got\n%s", want, out.String())
+		}
+	}
+}
+
+func TestGeneratePackNotFoundLeavesProjectUntouched(t *testing.T) {
+	defer newTestProject(t)()
+	before := snapshot(t)
+
+	c := &generateCmd{stdout: ioutil.Discard, name: "foo", pack: "does-not-exist"}
+	if err := c.run(); err == nil {
+		t.Fatal("expected an error for a missing pack")
+	}
+	assertUnchanged(t, before)
+}
+
+func TestDestroy(t *testing.T) {
+	defer newTestProject(t)()
+	before := snapshot(t)
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	assertUnchanged(t, before)
+	if _, err := os.Stat(recordsDir); !os.IsNotExist(err) {
+		t.Errorf("expected the empty %s to be removed, got %v", recordsDir, err)
+	}
+}
+
+func TestDestroyRefusesModifiedController(t *testing.T) {
+	defer newTestProject(t)()
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("foo", "hello.txt"), []byte("bonjour\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := (&destroyCmd{stdout: ioutil.Discard, name: "foo"}).run()
+	if err == nil || !strings.Contains(err.Error(), "hello.txt") {
+		t.Fatalf("expected destroy to refuse to remove a modified controller, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("foo", "hello.txt")); err != nil {
+		t.Errorf("expected foo/hello.txt to be left alone, got %v", err)
+	}
+
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo", force: true}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("foo"); !os.IsNotExist(err) {
+		t.Errorf("expected foo to be removed with --force, got %v", err)
+	}
+}
+
+func TestDestroyInvalidName(t *testing.T) {
+	defer newTestProject(t)()
+	before := snapshot(t)
+
+	for _, name := range []string{"", ".", "..", "/tmp", filepath.Join("config", "controllers"), filepath.Join("..", "foo")} {
+		if err := (&destroyCmd{stdout: ioutil.Discard, name: name, force: true}).run(); err == nil {
+			t.Errorf("expected destroy to reject the controller name %q", name)
+		}
+		if err := (&generateCmd{stdout: ioutil.Discard, name: name, pack: "test"}).run(); err == nil {
+			t.Errorf("expected generate to reject the controller name %q", name)
+		}
+	}
+	assertUnchanged(t, before)
+}
+
+func TestDestroyKeepsExistingDirectory(t *testing.T) {
+	defer newTestProject(t)()
+	if err := os.Mkdir("foo", 0755); err != nil {
+		t.Fatal(err)
+	}
+	mine := filepath.Join("foo", "main.c")
+	hello := filepath.Join("foo", "hello.txt")
+	for path, content := range map[string]string{mine: "int main() {}\n", hello: "mine\n"} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test", overwrite: "backup"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mine); err != nil {
+		t.Errorf("expected %s to be left in place, got %v", mine, err)
+	}
+	if _, err := os.Lstat(hello); !os.IsNotExist(err) {
+		t.Errorf("expected the generated files to be removed, got %v", err)
+	}
+	if b, err := ioutil.ReadFile(hello + ".bak"); err != nil || string(b) != "mine\n" {
+		t.Errorf("expected the backup of %s to be left in place, got %q, %v", hello, b, err)
+	}
+
+	// without a record, the directory is left in place even with --force
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo", force: true}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mine); err != nil {
+		t.Errorf("expected %s to be left in place, got %v", mine, err)
+	}
+}
+
+func TestGenerateTwiceIsIdempotent(t *testing.T) {
+	defer newTestProject(t)()
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshot(t)
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	after := snapshot(t)
+	for _, path := range []string{
+		filepath.Join("charts", "myapp", "values.yaml"),
+		filepath.Join("charts", "myapp", "templates", "_helpers.tpl"),
+	} {
+		if after[path] != before[path] {
+			t.Errorf("expected %s to be unchanged by generating the same controller twice, got\n%s", path, after[path])
+		}
+	}
+
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo"}).run(); err != nil {
+		t.Errorf("expected a controller generated twice to be destroyed cleanly, got %v", err)
+	}
+}
+
+func TestGenerateRouteConflict(t *testing.T) {
+	defer newTestProject(t)()
+	if err := ioutil.WriteFile(filepath.Join("config", "routes"), []byte("/api/\tapi\t3000\n/\tstatic\t8080\t/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshot(t)
+
+	c := &generateCmd{stdout: ioutil.Discard, name: "api", pack: "test"}
+	err := c.run()
+	if err == nil || !strings.Contains(err.Error(), "line 1: /api/ api 3000 (same path)") {
+		t.Fatalf("expected a route conflict naming the conflicting line, got %v", err)
+	}
+	assertUnchanged(t, before)
+
+	c.force = true
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := ioutil.ReadFile(filepath.Join("config", "routes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/api/\tapi\t3000\n/api/\tapi\t8080\n/\tstatic\t8080\t/\n"; string(routes) != want {
+		t.Errorf("expected the route to be added with --force, got %q", routes)
+	}
+}
+
+func TestGeneratePort(t *testing.T) {
+	defer newTestProject(t)()
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test", port: 3000}).run(); err != nil {
+		t.Fatal(err)
+	}
+	files := snapshot(t)
+	for path, want := range map[string][]string{
+		filepath.Join("charts", "myapp", "templates", "foo-deployment.yaml"): {"containerPort: 3000", "- name: PORT\n              value: \"3000\"", "readinessProbe:\n            httpGet:\n              path: \"/healthz\""},
+		filepath.Join("charts", "myapp", "templates", "foo-service.yaml"):    {"targetPort: 3000"},
+		filepath.Join("config", "routes"):                                    {"/foo/\tfoo\t3000\n"},
+	} {
+		for _, w := range want {
+			if !strings.Contains(files[path], w) {
+				t.Errorf("expected %s to contain %q, got\n%s", path, w, files[path])
+			}
+		}
+	}
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "bar", pack: "test", port: 70000}).run(); err == nil {
+		t.Error("expected an error for an invalid port")
+	}
+}
+
+func TestGenerateRoutesFile(t *testing.T) {
+	defer newTestProject(t)()
+	routesPath := filepath.Join("config", "routes")
+	if err := os.Remove(routesPath); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshot(t)
+
+	err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run()
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected an error for a missing routes file, got %v", err)
+	}
+	assertUnchanged(t, before)
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test", noRoute: true}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(routesPath); !os.IsNotExist(err) {
+		t.Errorf("expected --no-route to not create %s, got %v", routesPath, err)
+	}
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "bar", pack: "test", createRoutes: true}).run(); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := ioutil.ReadFile(routesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/bar/\tbar\t8080\n/\tstatic\t8080\t/\n"; string(routes) != want {
+		t.Errorf("expected %q, got %q", want, routes)
+	}
+
+	// destroying the controller without a route leaves the routes alone
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := ioutil.ReadFile(routesPath); string(after) != string(routes) {
+		t.Errorf("expected %s to be unchanged, got %q", routesPath, after)
+	}
+}
+
+func TestGenerateQualifiedPack(t *testing.T) {
+	defer newTestProject(t)()
+
+	// two repositories with a pack named test, at different versions
+	plugin, err := ioutil.TempDir("", "generator-controller-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(plugin)
+	for repoName, version := range map[string]string{"one": "1.0.0", "two": "2.0.0"} {
+		dir := filepath.Join(plugin, "packs", "github.com", "kubed", repoName, "packs", "test")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{
+			"pack.toml": "version = \"" + version + "\"\n",
+			"repo.txt":  repoName + "\n",
+		}
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	os.Setenv("KUBED_PLUGIN_DIR", plugin)
+
+	err = (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run()
+	if err == nil || !strings.Contains(err.Error(), "Multiple packs named test found") {
+		t.Fatalf("expected an error for an ambiguous pack, got %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		pack       string
+		precedence []string
+		want       string
+	}{
+		{"qualified", "github.com/kubed/two/test", nil, "two\n"},
+		{"versioned", "test@v1.0.0", nil, "one\n"},
+		{"precedence", "test", []string{"github.com/kubed/two", "github.com/kubed/one"}, "two\n"},
+	}
+	for _, tt := range tests {
+		c := &generateCmd{stdout: ioutil.Discard, name: tt.name, pack: tt.pack, repoPrecedence: tt.precedence}
+		if err := c.run(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(tt.name, "repo.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s: expected the pack from repository %q, got %q", tt.name, tt.want, b)
+		}
+	}
+
+	err = (&generateCmd{stdout: ioutil.Discard, name: "bar", pack: "test@3.0.0"}).run()
+	if err == nil || !strings.Contains(err.Error(), "No packs found") {
+		t.Errorf("expected an error for a missing pack version, got %v", err)
+	}
+}
+
+func TestGenerateVariables(t *testing.T) {
+	defer newTestProject(t)()
+
+	if err := ioutil.WriteFile("vars.yaml", []byte("owner: team-a\nreplicaCount: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &generateCmd{stdout: ioutil.Discard, name: "bar", pack: "test", valuesFiles: []string{"vars.yaml"}, setValues: []string{"replicaCount=3"}}
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+	files := snapshot(t)
+	if got := files[filepath.Join("bar", "owner.txt")]; got != "team-a\n" {
+		t.Errorf("expected the owner from the values file, got %q", got)
+	}
+	if got := files[filepath.Join("charts", "myapp", "values.yaml")]; !strings.Contains(got, "bar:\n  replicaCount: 3\n  image: {}\n") {
+		t.Errorf("expected --set to override the values file, got\n%s", got)
+	}
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "baz", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshot(t)[filepath.Join("baz", "owner.txt")]; got != "nobody\n" {
+		t.Errorf("expected the default owner, got %q", got)
+	}
+
+	before := snapshot(t)
+	c = &generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test", setValues: []string{"replicaCount=many", "colour=blue"}, setStringValues: []string{"owner=team-b"}}
+	err := c.run()
+	if err == nil {
+		t.Fatal("expected an error for invalid variables")
+	}
+	for _, want := range []string{`replicaCount: expected an int, got "many"`, "colour: the pack does not accept this variable"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to report %q, got %v", want, err)
+		}
+	}
+	assertUnchanged(t, before)
+}
+
+func TestRenderChartTemplate(t *testing.T) {
+	values := chartValues{
+		AppName:         "myapp",
+		Name:            "foo",
+		Port:            8080,
+		HealthCheckPath: "/health?ready=1&owner='team-a'\n",
+		Vars:            map[string]interface{}{"replicaCount": "#2"},
+	}
+	for _, tt := range []struct {
+		tpl  string
+		want string
+	}{
+		{deploymentTemplate, `path: "/health?ready=1&owner='team-a'\n"`},
+		{valuesTemplate, `replicaCount: "#2"`},
+	} {
+		b, err := renderChartTemplate(tt.tpl, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), tt.want) {
+			t.Errorf("expected %q in\n%s", tt.want, b)
+		}
+	}
+}
+
+func TestGenerateDetect(t *testing.T) {
+	defer newTestProject(t)()
+
+	err := (&generateCmd{stdout: ioutil.Discard, name: "foo"}).run()
+	if err == nil || !strings.Contains(err.Error(), "No packs found with name nodejs") {
+		t.Errorf("expected the default pack to be used for a new controller, got %v", err)
+	}
+	err = (&generateCmd{stdout: ioutil.Discard, name: "foo", detect: true}).run()
+	if err == nil || !strings.Contains(err.Error(), "could not detect") {
+		t.Errorf("expected an error detecting the pack of a missing directory, got %v", err)
+	}
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test", detect: true}).run(); err == nil {
+		t.Error("expected an error using --detect with --pack")
+	}
+
+	if err := os.MkdirAll(filepath.Join("api", "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("api", "src", "main.test"), []byte("test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := (&generateCmd{stdout: out, name: "api"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "--> Detected pack github.com/kubed/testpacks/test") {
+		t.Errorf("expected the test pack to be detected, got %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join("api", "hello.txt")); err != nil {
+		t.Errorf("expected the detected pack to be scaffolded: %v", err)
+	}
+}
+
+func TestGenerateOverwrite(t *testing.T) {
+	defer newTestProject(t)()
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	hello := filepath.Join("foo", "hello.txt")
+	original, err := ioutil.ReadFile(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify := func() {
+		if err := ioutil.WriteFile(hello, []byte("modified\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modify()
+
+	out := new(bytes.Buffer)
+	if err := (&generateCmd{stdout: out, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "skipped       "+hello+"\n") || !strings.Contains(out.String(), "Existing files were left untouched") {
+		t.Errorf("expected %s to be reported as skipped, got\n%s", hello, out)
+	}
+
+	err = (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test", overwrite: "fail"}).run()
+	if _, ok := err.(*pack.FileExistsError); !ok {
+		t.Errorf("expected a *pack.FileExistsError, got %v", err)
+	}
+
+	out.Reset()
+	if err := (&generateCmd{stdout: out, name: "foo", pack: "test", overwrite: "backup"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(hello); string(b) != string(original) {
+		t.Errorf("expected %s to be overwritten, got %q", hello, b)
+	}
+	if b, _ := ioutil.ReadFile(hello + ".bak"); string(b) != "modified\n" {
+		t.Errorf("expected %s to be backed up, got %q", hello, b)
+	}
+	if !strings.Contains(out.String(), "overwritten   "+hello+"\n") || !strings.Contains(out.String(), "backed up to  "+hello+".bak\n") {
+		t.Errorf("expected %s to be reported as backed up and overwritten, got\n%s", hello, out)
+	}
+
+	// an earlier backup is kept
+	if err := ioutil.WriteFile(hello, []byte("modified again\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test", overwrite: "backup"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(hello + ".bak"); string(b) != "modified\n" {
+		t.Errorf("expected the earlier backup of %s to be kept, got %q", hello, b)
+	}
+	if b, _ := ioutil.ReadFile(hello + ".bak.1"); string(b) != "modified again\n" {
+		t.Errorf("expected %s to be backed up to %s.bak.1, got %q", hello, hello, b)
+	}
+
+	modify()
+	out.Reset()
+	c := &generateCmd{stdout: out, stdin: strings.NewReader("d\no\n"), name: "foo", pack: "test", overwrite: "merge-prompt"}
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "-modified\n") {
+		t.Errorf("expected the diff to be shown, got\n%s", out)
+	}
+	if b, _ := ioutil.ReadFile(hello); string(b) != string(original) {
+		t.Errorf("expected %s to be overwritten after prompting, got %q", hello, b)
+	}
+
+	// a dry run does not prompt
+	modify()
+	before := snapshot(t)
+	out.Reset()
+	c = &generateCmd{stdout: out, stdin: strings.NewReader("o\n"), name: "foo", pack: "test", overwrite: "merge-prompt", dryRun: true}
+	if err := c.run(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "[s]kip") || !strings.Contains(out.String(), "--> "+hello+" already exists and would be prompted for\n") {
+		t.Errorf("expected %s to be reported without prompting, got\n%s", hello, out)
+	}
+	if after := snapshot(t); after[hello] != before[hello] {
+		t.Errorf("expected %s to be left untouched by a dry run, got %q", hello, after[hello])
+	}
+	if err := ioutil.WriteFile(hello, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "bar", pack: "test", overwrite: "clobber"}).run(); err == nil {
+		t.Error("expected an error for an unknown overwrite policy")
+	}
+
+	// the backups are part of what was generated
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo"}).run(); err != nil {
+		t.Errorf("expected a controller with backups to be destroyed cleanly, got %v", err)
+	}
+}
+
+func TestDestroyUnchangedFiles(t *testing.T) {
+	defer newTestProject(t)()
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	// a record that does not list the pack files, as when they already existed
+	record, err := loadRecord(vfs.OS, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Files = nil
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(recordPath("foo"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&generateCmd{stdout: ioutil.Discard, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&destroyCmd{stdout: ioutil.Discard, name: "foo"}).run(); err != nil {
+		t.Errorf("expected the files that were left unchanged to be recorded, got %v", err)
+	}
+}
+
+// newMemProject creates a kubed project in memory, with the packs of testdata/plugin.
+func newMemProject(t *testing.T) *vfs.MemFS {
+	m := vfs.NewMemFS()
+	plugin := filepath.Join("testdata", "plugin")
+	err := filepath.Walk(plugin, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(plugin, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join("/plugin", rel)
+		switch {
+		case fi.IsDir():
+			return m.MkdirAll(dest, fi.Mode().Perm())
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return m.Symlink(target, dest)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return m.WriteFile(dest, b, fi.Mode().Perm())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join("config", "kubed.toml"):                         testKubedToml,
+		filepath.Join("config", "routes"):                             testRoutes,
+		filepath.Join("charts", "myapp", "values.yaml"):               testValues,
+		filepath.Join("charts", "myapp", "templates", "_helpers.tpl"): testHelpers,
+	}
+	for name, content := range files {
+		if err := m.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestGenerateInMemory(t *testing.T) {
+	m := newMemProject(t)
+	os.Setenv("KUBED_PLUGIN_DIR", "/plugin")
+	defer os.Unsetenv("KUBED_PLUGIN_DIR")
+
+	if err := (&generateCmd{stdout: ioutil.Discard, fsys: m, name: "foo", pack: "test"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("foo"); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written to disk, got %v", err)
+	}
+
+	greeting, err := m.ReadFile(filepath.Join("foo", "greeting.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "foo is part of myapp and listens on port 8080 in development\n"; string(greeting) != want {
+		t.Errorf("expected the pack template to be rendered as %q, got %q", want, greeting)
+	}
+	if fi, err := m.Stat(filepath.Join("foo", "run.sh")); err != nil || fi.Mode()&0111 == 0 {
+		t.Errorf("expected run.sh to be created executable, got %v, %v", fi, err)
+	}
+	if target, err := m.ReadLink(filepath.Join("foo", "start.sh")); err != nil || target != "run.sh" {
+		t.Errorf("expected start.sh to be created as a symlink to run.sh, got %q, %v", target, err)
+	}
+	routes, err := m.ReadFile(filepath.Join("config", "routes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(routes), "/foo/\tfoo\t8080\n/\tstatic") {
+		t.Errorf("expected route to be added above the default route, got %q", routes)
+	}
+
+	if err := (&destroyCmd{stdout: ioutil.Discard, fsys: m, name: "foo"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stat("foo"); !os.IsNotExist(err) {
+		t.Errorf("expected foo to be removed, got %v", err)
+	}
+	routes, err = m.ReadFile(filepath.Join("config", "routes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(routes) != testRoutes {
+		t.Errorf("expected the route to be removed, got %q", routes)
+	}
+}
+
+func TestGenerateBundledPack(t *testing.T) {
+	m := newMemProject(t)
+	repo.Builtin = packs.FS
+	defer func() { repo.Builtin = nil }()
+
+	// without a plugin directory, the only packs are the bundled ones
+	if err := (&generateCmd{stdout: ioutil.Discard, fsys: m, name: "foo"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := m.Stat(filepath.Join("foo", "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Errorf("expected the Dockerfile of the bundled pack to be created with mode 0644, got %v", fi.Mode())
+	}
+	record, err := loadRecord(m, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Pack != defaultPack {
+		t.Errorf("expected the controller to be generated with the bundled pack %s, got %s", defaultPack, record.Pack)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
+)
+
+const packRepoUsage = `Manages the pack repositories starter packs are found in.
+
+Pack repositories are installed under $KUBED_PLUGIN_DIR/packs/<host>/<org>/<repo>. They can be
+added from a git URL, such as https://github.com/org/repo or file:///srv/git/repo.git, or
+from a local directory. Repositories added from a local directory are installed under
+local/<org>/<repo>, using the last two elements of the directory's path.
+
+They can also be added from a .tar.gz archive, given as a file or an HTTP URL, which must be
+verified with --sha256 or with --signature and --keyring.
+`
+
+func newPackRepoCmd(stdout io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pack-repo",
+		Short: "manages pack repositories",
+		Long:  packRepoUsage,
+	}
+	cmd.AddCommand(
+		newPackRepoAddCmd(stdout),
+		newPackRepoUpdateCmd(stdout),
+		newPackRepoRemoveCmd(stdout),
+		newPackRepoListCmd(stdout),
+	)
+	return cmd
+}
+
+type packRepoAddCmd struct {
+	stdout    io.Writer
+	source    string
+	version   string
+	sha256    string
+	signature string
+	keyring   string
+}
+
+func newPackRepoAddCmd(stdout io.Writer) *cobra.Command {
+	c := &packRepoAddCmd{
+		stdout: stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "add <url|path>",
+		Short: "installs a pack repository",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c.source = args[0]
+			return c.run()
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&c.version, "version", "", "the tag or commit of a git repository to install, defaulting to its default branch, or the version to record for an archive")
+	f.StringVar(&c.sha256, "sha256", "", "the SHA-256 checksum a .tar.gz archive must have")
+	f.StringVar(&c.signature, "signature", "", "the file holding a detached OpenPGP signature of a .tar.gz archive")
+	f.StringVar(&c.keyring, "keyring", "", "the file holding the OpenPGP public keys to check --signature with")
+
+	return cmd
+}
+
+func (c *packRepoAddCmd) run() error {
+	var (
+		r   *repo.Repository
+		err error
+	)
+	if repo.IsArchive(c.source) {
+		var v repo.Verification
+		if v, err = c.verification(); err != nil {
+			return err
+		}
+		r, err = repo.AddArchive(packsDir(), c.source, c.version, v)
+	} else {
+		r, err = repo.Add(packsDir(), c.source, c.version)
+	}
+	if err != nil {
+		return fmt.Errorf("could not add pack repo %s: %v", c.source, err)
+	}
+	fmt.Fprintf(c.stdout, "--> Installed pack repo %s", r.Name)
+	if r.Version != "" {
+		fmt.Fprintf(c.stdout, " at %s", r.Version)
+	}
+	fmt.Fprintln(c.stdout)
+	return nil
+}
+
+// verification returns how the archive being added is verified.
+func (c *packRepoAddCmd) verification() (repo.Verification, error) {
+	v := repo.Verification{SHA256: c.sha256}
+	if (c.signature == "") != (c.keyring == "") {
+		return v, errors.New("--signature and --keyring must be given together")
+	}
+	if c.signature != "" {
+		var err error
+		if v.Signature, err = ioutil.ReadFile(c.signature); err != nil {
+			return v, err
+		}
+		if v.Keyring, err = ioutil.ReadFile(c.keyring); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+type packRepoUpdateCmd struct {
+	stdout  io.Writer
+	name    string
+	version string
+}
+
+func newPackRepoUpdateCmd(stdout io.Writer) *cobra.Command {
+	c := &packRepoUpdateCmd{
+		stdout: stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "update [name]",
+		Short: "updates the installed pack repositories, or the named one",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				c.name = args[0]
+			}
+			return c.run()
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&c.version, "version", "", "the tag or commit to check the named git repository out at. Defaults to the latest commit of its default branch")
+
+	return cmd
+}
+
+func (c *packRepoUpdateCmd) run() error {
+	var repos []repo.Repository
+	if c.name != "" {
+		r, err := repo.FindRepository(packsDir(), c.name)
+		if err != nil {
+			return fmt.Errorf("could not update pack repo %s: %v", c.name, err)
+		}
+		repos = append(repos, *r)
+	} else {
+		if c.version != "" {
+			return fmt.Errorf("--version can only be used when updating a single pack repo")
+		}
+		for _, r := range repo.FindRepositories(packsDir()) {
+			// the bundled packs are updated along with the generator
+			if !r.Builtin {
+				repos = append(repos, r)
+			}
+		}
+	}
+
+	for _, r := range repos {
+		err := r.Update(c.version)
+		if err == repo.ErrMissingSource && c.name == "" {
+			// repositories copied in by hand cannot be updated, but should not stop the others
+			fmt.Fprintf(c.stdout, "--> Skipped pack repo %s: it was not installed with pack-repo add\n", r.Name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not update pack repo %s: %v", r.Name, err)
+		}
+		fmt.Fprintf(c.stdout, "--> Updated pack repo %s to %s\n", r.Name, r.Version)
+	}
+	return nil
+}
+
+type packRepoRemoveCmd struct {
+	stdout io.Writer
+	name   string
+}
+
+func newPackRepoRemoveCmd(stdout io.Writer) *cobra.Command {
+	c := &packRepoRemoveCmd{
+		stdout: stdout,
+	}
+
+	return &cobra.Command{
+		Use:   "remove <name>",
+		Short: "removes an installed pack repository",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c.name = args[0]
+			return c.run()
+		},
+	}
+}
+
+func (c *packRepoRemoveCmd) run() error {
+	if err := repo.Remove(packsDir(), c.name); err != nil {
+		return fmt.Errorf("could not remove pack repo %s: %v", c.name, err)
+	}
+	fmt.Fprintf(c.stdout, "--> Removed pack repo %s\n", c.name)
+	return nil
+}
+
+func newPackRepoListCmd(stdout io.Writer) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "lists the installed pack repositories",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSOURCE\tVERSION")
+			for _, r := range repo.FindRepositories(packsDir()) {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Source, r.Version)
+			}
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackRepo(t *testing.T) {
+	source, err := filepath.Abs(filepath.Join("testdata", "plugin", "packs", "github.com", "kubed", "testpacks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin, err := ioutil.TempDir("", "generator-controller-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(plugin)
+	os.Setenv("KUBED_PLUGIN_DIR", plugin)
+	defer os.Unsetenv("KUBED_PLUGIN_DIR")
+
+	var out bytes.Buffer
+	if err := (&packRepoAddCmd{stdout: &out, source: source}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(plugin, "packs", "local", "kubed", "testpacks", "packs", "test", "hello.txt")); err != nil {
+		t.Errorf("expected the test pack to be installed: %v", err)
+	}
+	if err := (&packRepoAddCmd{stdout: &out, source: source}).run(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error adding the pack repo twice, got %v", err)
+	}
+
+	out.Reset()
+	if err := newPackRepoListCmd(&out).RunE(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "local/kubed/testpacks  "+source) {
+		t.Errorf("expected the pack repo to be listed, got\n%s", out.String())
+	}
+
+	// a repository copied in by hand has no source to be updated from
+	if err := os.MkdirAll(filepath.Join(plugin, "packs", "default", "packs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := (&packRepoUpdateCmd{stdout: &out}).run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--> Updated pack repo local/kubed/testpacks", "--> Skipped pack repo default"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the output, got\n%s", want, out.String())
+		}
+	}
+	if err := (&packRepoUpdateCmd{stdout: &out, name: "default"}).run(); err == nil {
+		t.Error("expected an error updating a pack repo without a source")
+	}
+	if err := (&packRepoUpdateCmd{stdout: &out, name: "local/kubed/missing"}).run(); err == nil {
+		t.Error("expected an error updating a missing pack repo")
+	}
+
+	if err := (&packRepoRemoveCmd{stdout: &out, name: "local/kubed/testpacks"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(plugin, "packs", "local")); !os.IsNotExist(err) {
+		t.Errorf("expected the pack repo to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
+)
+
+const packsListUsage = `Lists the starter packs available to scaffold controllers with.
+
+Packs are searched for in every pack repository under $KUBED_PLUGIN_DIR/packs. Use --repo to
+only list the packs of one repository, and --output to print the list as JSON or YAML.
+`
+
+// packsDir returns the directory pack repositories are installed in. If KUBED_PLUGIN_DIR is
+// unset, it falls back to ./packs.
+func packsDir() string {
+	return filepath.Join(os.Getenv("KUBED_PLUGIN_DIR"), "packs")
+}
+
+func newPacksCmd(stdout io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "packs",
+		Aliases: []string{"pack"},
+		Short:   "manages starter packs",
+	}
+	cmd.AddCommand(
+		newPacksListCmd(stdout),
+		newPacksLintCmd(stdout),
+	)
+	return cmd
+}
+
+type packsListCmd struct {
+	stdout io.Writer
+	repo   string
+	output string
+}
+
+func newPacksListCmd(stdout io.Writer) *cobra.Command {
+	c := &packsListCmd{
+		stdout: stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "lists the available starter packs",
+		Long:  packsListUsage,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.run()
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&c.repo, "repo", "", "only list the packs of the named pack repository")
+	f.StringVarP(&c.output, "output", "o", "table", "the output format: table, json or yaml")
+
+	return cmd
+}
+
+func (c *packsListCmd) run() error {
+	if c.repo != "" && !repoExists(packsDir(), c.repo) {
+		return fmt.Errorf("%v: %s", repo.ErrDoesNotExist, c.repo)
+	}
+	infos, err := pack.ListInfo(packsDir(), c.repo)
+	if err != nil {
+		return err
+	}
+	if infos == nil {
+		infos = []pack.Info{}
+	}
+
+	switch c.output {
+	case "table":
+		w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tPACK\tVERSION\tDESCRIPTION")
+		for _, info := range infos {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Repository, info.Name, info.Version, info.Description)
+		}
+		return w.Flush()
+	case "json":
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	case "yaml":
+		out, err := yaml.Marshal(infos)
+		if err != nil {
+			return err
+		}
+		_, err = c.stdout.Write(out)
+		return err
+	default:
+		return fmt.Errorf("unknown output format %q: must be one of table, json or yaml", c.output)
+	}
+}
+
+const packsLintUsage = `Checks that the starter pack in a directory follows the conventions the generator relies on.
+
+The pack must have valid metadata and a .dockerignore. The final stage of its Dockerfile must
+EXPOSE the port of the pack and set the PORT environment variable to it, the port being the one
+declared in pack.toml, or else %d. It must not use ONBUILD, which only runs when another image
+is built from the image, and its base images must be pinned to a tag other than "latest", or to
+a digest.
+
+Each problem is printed with its file and line, and the command fails if there is any.
+`
+
+type packsLintCmd struct {
+	stdout io.Writer
+	dir    string
+}
+
+func newPacksLintCmd(stdout io.Writer) *cobra.Command {
+	c := &packsLintCmd{
+		stdout: stdout,
+	}
+
+	return &cobra.Command{
+		Use:   "lint <dir>",
+		Short: "checks a starter pack",
+		Long:  fmt.Sprintf(packsLintUsage, pack.DefaultPort),
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c.dir = args[0]
+			return c.run()
+		},
+	}
+}
+
+func (c *packsLintCmd) run() error {
+	findings, err := pack.Lint(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		f.File = filepath.Join(c.dir, f.File)
+		fmt.Fprintln(c.stdout, f)
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("pack %s has %d problem(s)", c.dir, len(findings))
+	}
+	fmt.Fprintf(c.stdout, "--> Pack %s follows the conventions\n", c.dir)
+	return nil
+}
+
+// repoExists reports whether a pack repository with the given name is installed in packsDir.
+func repoExists(packsDir, name string) bool {
+	for _, r := range repo.FindRepositories(packsDir) {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack"
+)
+
+func TestPacksList(t *testing.T) {
+	defer newTestProject(t)()
+
+	var out bytes.Buffer
+	if err := (&packsListCmd{stdout: &out, output: "json"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	var got []pack.Info
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("could not decode %q: %v", out.String(), err)
+	}
+	want := []pack.Info{
+		{Repository: "github.com/kubed/testpacks", Name: "test", Description: "A pack used by the tests", Version: "1.0.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	out.Reset()
+	if err := (&packsListCmd{stdout: &out, output: "table"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "github.com/kubed/testpacks  test  1.0.0    A pack used by the tests") {
+		t.Errorf("expected the test pack in the table, got\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := (&packsListCmd{stdout: &out, output: "yaml"}).run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "- repository: github.com/kubed/testpacks\n  name: test\n") {
+		t.Errorf("expected the test pack in the YAML output, got\n%s", out.String())
+	}
+
+	if err := (&packsListCmd{stdout: &out, output: "xml"}).run(); err == nil {
+		t.Error("expected an error for an unknown output format")
+	}
+	if err := (&packsListCmd{stdout: &out, repo: "github.com/kubed/missing", output: "table"}).run(); err == nil {
+		t.Error("expected an error for an unknown pack repository")
+	}
+}
+
+func TestPacksLint(t *testing.T) {
+	var out bytes.Buffer
+	dir := filepath.Join("..", "..", "packs", "clojure")
+	if err := (&packsLintCmd{stdout: &out, dir: dir}).run(); err != nil {
+		t.Fatalf("expected the clojure pack to follow the conventions, got %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	dir, err := ioutil.TempDir("", "generator-controller-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"pack.toml":  "name = \"bad\"\n",
+		"Dockerfile": "FROM swift\nONBUILD RUN swift build\nENV PORT 8080\nEXPOSE 8080\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (&packsLintCmd{stdout: &out, dir: dir}).run(); err == nil {
+		t.Error("expected an error for a pack that does not follow the conventions")
+	}
+	for _, want := range []string{
+		filepath.Join(dir, ".dockerignore") + ": missing",
+		filepath.Join(dir, "Dockerfile") + ":1: base image swift",
+		filepath.Join(dir, "Dockerfile") + ":2: \"ONBUILD RUN swift build\"",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the output, got\n%s", want, out.String())
+		}
+	}
+}
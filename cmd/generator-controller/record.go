@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/changeset"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// controllerRecord records what was generated for a controller, so that it can be removed
+// again with `destroy`.
+type controllerRecord struct {
+	// Pack is the name of the pack the controller was scaffolded with.
+	Pack string `toml:"pack"`
+	// Route is the line that was added to config/routes.
+	Route string `toml:"route"`
+	// CreatedDir is whether the source directory was created by the generator. If it was not,
+	// only the generated files are removed from it.
+	CreatedDir bool `toml:"created-dir"`
+	// Files maps each file generated in the source directory to its SHA-256 checksum, including
+	// the pack files that already existed with the same content and the backups of existing
+	// files.
+	Files map[string]string `toml:"files"`
+	// Backups are the files in Files that existing files were backed up to. They are left in
+	// place if the source directory is not removed.
+	Backups []string `toml:"backups"`
+}
+
+// recordsDir is the directory where the generation records are kept.
+var recordsDir = filepath.Join("config", "controllers")
+
+// recordPath returns the path where the generation record for the named controller is kept.
+func recordPath(name string) string {
+	return filepath.Join(recordsDir, name+".toml")
+}
+
+// isBackup reports whether the file at relPath in the source directory is a backup.
+func (r *controllerRecord) isBackup(relPath string) bool {
+	for _, b := range r.Backups {
+		if b == relPath {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRecord loads the generation record for the named controller from fsys. It returns nil if
+// the controller has no record.
+func loadRecord(fsys vfs.FS, name string) (*controllerRecord, error) {
+	b, err := fsys.ReadFile(recordPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r := new(controllerRecord)
+	if _, err := toml.Decode(string(b), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// stageRecord stages the generation record for the named controller.
+func stageRecord(cs *changeset.Changeset, name string, r *controllerRecord) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(r); err != nil {
+		return err
+	}
+	return cs.WriteFile(recordPath(name), buf.Bytes(), 0644)
+}
+
+// modified returns the files in dir in fsys that were added, changed or removed since the
+// record was written. Files that were added are only reported if the generator created dir,
+// since they are otherwise left in place.
+func (r *controllerRecord) modified(fsys vfs.FS, dir string) ([]string, error) {
+	var modified []string
+	seen := make(map[string]bool)
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := checksumFile(fsys, path, fi)
+		if err != nil {
+			return err
+		}
+		if recorded, ok := r.Files[rel]; ok && recorded != sum || !ok && r.CreatedDir {
+			modified = append(modified, rel)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for rel := range r.Files {
+		if !seen[rel] {
+			modified = append(modified, rel)
+		}
+	}
+	sort.Strings(modified)
+	return modified, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checksumFile returns the checksum of the content of a regular file in fsys, or of the target
+// of a symlink.
+func checksumFile(fsys vfs.FS, path string, fi os.FileInfo) (string, error) {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := fsys.ReadLink(path)
+		if err != nil {
+			return "", err
+		}
+		return checksum([]byte(target)), nil
+	}
+	b, err := fsys.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return checksum(b), nil
+}
@@ -0,0 +1 @@
+run.sh
\ No newline at end of file
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack"
+)
+
+// variables returns the variable values given with --values, --set and --set-string, in that
+// order of precedence: values set with --set override the ones from values files, and values
+// set with --set-string override both.
+func (c *generateCmd) variables() (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	for _, path := range c.valuesFiles {
+		b, err := projectFS(c.fsys).ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]interface{})
+		if err := yaml.Unmarshal(b, &values); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", path, err)
+		}
+		for k, v := range values {
+			vars[k] = v
+		}
+	}
+	for _, s := range c.setValues {
+		k, v, err := parseSet(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --set %q: %v", s, err)
+		}
+		vars[k] = pack.RawValue(v)
+	}
+	for _, s := range c.setStringValues {
+		k, v, err := parseSet(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --set-string %q: %v", s, err)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// parseSet parses a key=value pair.
+func parseSet(s string) (string, string, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return "", "", fmt.Errorf("expected key=value")
+	}
+	return s[:i], s[i+1:], nil
+}
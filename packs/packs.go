@@ -0,0 +1,10 @@
+// Package packs holds the packs bundled with the generator, so that it works without any pack
+// repository installed.
+package packs
+
+import "embed"
+
+// FS holds the bundled packs, one directory per pack.
+//
+//go:embed all:clojure all:dotnet all:go all:maven all:nodejs all:php all:python all:ruby all:rust all:swift
+var FS embed.FS
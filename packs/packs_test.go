@@ -0,0 +1,44 @@
+package packs
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+func TestEveryPackIsBundled(t *testing.T) {
+	entries, err := ioutil.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := fs.Stat(FS, e.Name()+"/pack.toml"); err != nil {
+			t.Errorf("expected pack %s to be bundled, got %v", e.Name(), err)
+		}
+	}
+}
+
+func TestEveryPackFollowsTheConventions(t *testing.T) {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := vfs.Mount(vfs.NewMemFS(), "packs", FS)
+	for _, e := range entries {
+		findings, err := pack.LintFS(fsys, filepath.Join("packs", e.Name()))
+		if err != nil {
+			t.Errorf("could not lint pack %s: %v", e.Name(), err)
+			continue
+		}
+		for _, f := range findings {
+			t.Errorf("pack %s: %s", e.Name(), f)
+		}
+	}
+}
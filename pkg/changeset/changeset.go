@@ -0,0 +1,337 @@
+package changeset
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// Change represents a staged change to a single file.
+type Change struct {
+	// Path is the path of the file being changed.
+	Path string
+	// Before is the content of the file before the change. It is nil if the file did not exist.
+	Before []byte
+	// After is the content of the file after the change.
+	After []byte
+	// Mode is the file mode the file is written with. If os.ModeSymlink is set, the file is a
+	// symlink and After is its target.
+	Mode os.FileMode
+	// beforeMode is the mode of the file before the change, used to restore it on rollback.
+	beforeMode os.FileMode
+	// Deleted is true if the change removes the file.
+	Deleted bool
+}
+
+// Created reports whether the change creates a new file.
+func (c *Change) Created() bool {
+	return c.Before == nil
+}
+
+// IsSymlink reports whether the change leaves a symlink at its path.
+func (c *Change) IsSymlink() bool {
+	return c.Mode&os.ModeSymlink != 0
+}
+
+// Changeset is a set of file changes that have been staged but not yet written to the file system.
+//
+// Reads through a Changeset see the staged content, so a file can be modified several times
+// before the changes are applied.
+type Changeset struct {
+	fsys    vfs.FS
+	changes map[string]*Change
+	dirs    map[string]os.FileMode
+	rmdirs  map[string]os.FileMode
+}
+
+// New creates an empty Changeset for files on disk.
+func New() *Changeset {
+	return NewFS(vfs.OS)
+}
+
+// NewFS creates an empty Changeset for files in fsys.
+func NewFS(fsys vfs.FS) *Changeset {
+	return &Changeset{
+		fsys:    fsys,
+		changes: make(map[string]*Change),
+		dirs:    make(map[string]os.FileMode),
+		rmdirs:  make(map[string]os.FileMode),
+	}
+}
+
+// ReadFile returns the staged content of the named file, falling back to the content on disk.
+// Symlinks are followed, staged or not, up to vfs.MaxSymlinks of them.
+func (c *Changeset) ReadFile(path string) ([]byte, error) {
+	resolved, err := c.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	if ch, ok := c.changes[resolved]; ok {
+		if ch.Deleted {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		return ch.After, nil
+	}
+	return c.fsys.ReadFile(resolved)
+}
+
+// ReadLink returns the staged target of the named symlink, falling back to the symlink on disk.
+func (c *Changeset) ReadLink(path string) (string, error) {
+	if ch, ok := c.changes[filepath.Clean(path)]; ok {
+		if ch.Deleted || !ch.IsSymlink() {
+			return "", &os.PathError{Op: "readlink", Path: path, Err: os.ErrInvalid}
+		}
+		return string(ch.After), nil
+	}
+	return c.fsys.ReadLink(path)
+}
+
+// resolve returns the path the symlink at path points to, staged or not, following the
+// symlinks it points to in turn, or path itself if it is not a symlink.
+func (c *Changeset) resolve(op, path string) (string, error) {
+	path = filepath.Clean(path)
+	for links := 0; ; links++ {
+		var target string
+		if ch, ok := c.changes[path]; ok {
+			if ch.Deleted || !ch.IsSymlink() {
+				return path, nil
+			}
+			target = string(ch.After)
+		} else if fi, err := c.fsys.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if target, err = c.fsys.ReadLink(path); err != nil {
+				return "", err
+			}
+		} else {
+			return path, nil
+		}
+		if links == vfs.MaxSymlinks {
+			return "", &os.PathError{Op: op, Path: path, Err: vfs.ErrTooManyLinks}
+		}
+		path = resolveLink(path, target)
+	}
+}
+
+// resolveLink returns the path a symlink at path with the given target points to.
+func resolveLink(path, target string) string {
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(filepath.Dir(path), target)
+}
+
+// Exists reports whether the named file exists, either on disk or as a staged change.
+func (c *Changeset) Exists(path string) (bool, error) {
+	if ch, ok := c.changes[filepath.Clean(path)]; ok {
+		return !ch.Deleted, nil
+	}
+	_, err := c.fsys.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// change returns the staged change for path, creating it from the file on disk if necessary.
+func (c *Changeset) change(path string, mode os.FileMode) (*Change, error) {
+	if ch, ok := c.changes[path]; ok {
+		return ch, nil
+	}
+	ch := &Change{Path: path, Mode: mode}
+	fi, err := c.fsys.Lstat(path)
+	switch {
+	case err == nil && fi.IsDir():
+		return nil, fmt.Errorf("%s is a directory", path)
+	case err == nil && fi.Mode()&os.ModeSymlink != 0:
+		target, err := c.fsys.ReadLink(path)
+		if err != nil {
+			return nil, err
+		}
+		ch.Before = []byte(target)
+		ch.Mode = fi.Mode() & (os.ModeSymlink | os.ModePerm)
+		ch.beforeMode = ch.Mode
+	case err == nil:
+		before, err := c.fsys.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ch.Before = before
+		ch.Mode = fi.Mode().Perm()
+		ch.beforeMode = ch.Mode
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	c.changes[path] = ch
+	return ch, nil
+}
+
+// WriteFile stages data to be written to the named file.
+//
+// If a regular file already exists on disk, its mode is preserved. A symlink is replaced by a
+// regular file.
+func (c *Changeset) WriteFile(path string, data []byte, mode os.FileMode) error {
+	ch, err := c.change(filepath.Clean(path), mode)
+	if err != nil {
+		return err
+	}
+	if ch.IsSymlink() {
+		ch.Mode = mode
+	}
+	ch.After = append([]byte{}, data...)
+	ch.Deleted = false
+	return nil
+}
+
+// Symlink stages a symlink to target to be created at path, replacing the file there if any.
+func (c *Changeset) Symlink(target, path string) error {
+	ch, err := c.change(filepath.Clean(path), os.ModeSymlink|os.ModePerm)
+	if err != nil {
+		return err
+	}
+	ch.Mode = os.ModeSymlink | os.ModePerm
+	ch.After = []byte(target)
+	ch.Deleted = false
+	return nil
+}
+
+// AppendFile stages data to be appended to the named file, creating it if necessary.
+func (c *Changeset) AppendFile(path string, data []byte, mode os.FileMode) error {
+	content, err := c.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return c.WriteFile(path, append(content, data...), mode)
+}
+
+// MkdirAll stages the named directory to be created along with any missing parents.
+func (c *Changeset) MkdirAll(path string, mode os.FileMode) {
+	c.dirs[filepath.Clean(path)] = mode
+}
+
+// Remove stages the named file to be removed.
+func (c *Changeset) Remove(path string) error {
+	path = filepath.Clean(path)
+	if ch, ok := c.changes[path]; ok && ch.Created() {
+		// the file only exists as a staged change, so there is nothing to remove from disk
+		delete(c.changes, path)
+		return nil
+	}
+	exists, err := c.Exists(path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	ch, err := c.change(path, 0644)
+	if err != nil {
+		return err
+	}
+	ch.After = nil
+	ch.Deleted = true
+	return nil
+}
+
+// RemoveAll stages the named directory and everything it contains to be removed.
+func (c *Changeset) RemoveAll(path string) error {
+	return fs.WalkDir(c.fsys, path, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			c.rmdirs[filepath.Clean(walkPath)] = fi.Mode().Perm()
+			return nil
+		}
+		return c.Remove(walkPath)
+	})
+}
+
+// Changes returns the staged changes, sorted by path. Changes that leave a file untouched, with
+// the same content and mode, are omitted.
+func (c *Changeset) Changes() []*Change {
+	changes := make([]*Change, 0, len(c.changes))
+	for _, ch := range c.changes {
+		if !ch.Created() && !ch.Deleted && bytes.Equal(ch.Before, ch.After) && ch.IsSymlink() == (ch.beforeMode&os.ModeSymlink != 0) && (ch.IsSymlink() || ch.Mode == ch.beforeMode) {
+			continue
+		}
+		changes = append(changes, ch)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// Apply writes all staged changes to the file system.
+//
+// The changes are applied atomically: the new content of every file is first written to a
+// temporary file next to its destination and only then moved into place. If any step fails,
+// every file and directory touched so far is restored to its original state.
+func (c *Changeset) Apply() (err error) {
+	t := newTransaction(c.fsys)
+	defer func() {
+		if err != nil {
+			if rerr := t.rollback(); rerr != nil {
+				err = fmt.Errorf("%v (rolling back changes also failed: %v)", err, rerr)
+			}
+		}
+	}()
+
+	for _, dir := range sortedDirs(c.dirs, false) {
+		if err := t.mkdirAll(dir, c.dirs[dir]); err != nil {
+			return err
+		}
+	}
+
+	changes := c.Changes()
+	temps := make([]string, len(changes))
+	for i, ch := range changes {
+		if ch.Deleted {
+			continue
+		}
+		if err := t.mkdirAll(filepath.Dir(ch.Path), 0755); err != nil {
+			return err
+		}
+		tmp, err := t.writeTemp(ch)
+		if err != nil {
+			return err
+		}
+		temps[i] = tmp
+	}
+	for i, ch := range changes {
+		if err := t.commit(temps[i], ch); err != nil {
+			return err
+		}
+	}
+
+	// remove the deepest directories first so that each one is empty by the time it is removed
+	for _, dir := range sortedDirs(c.rmdirs, true) {
+		if err := t.rmdir(dir, c.rmdirs[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedDirs returns the directories in dirs sorted by path, so that parents come before their
+// children, or after them if reverse is true.
+func sortedDirs(dirs map[string]os.FileMode, reverse bool) []string {
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	} else {
+		sort.Strings(sorted)
+	}
+	return sorted
+}
@@ -0,0 +1,411 @@
+package changeset
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+func TestChangesetStagesWithoutWriting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changeset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "values.yaml")
+	if err := ioutil.WriteFile(existing, []byte("buildID: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := New()
+	created := filepath.Join(dir, "nested", "new.txt")
+	if err := cs.WriteFile(created, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.AppendFile(existing, []byte("foo:\n  image: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("expected %s to not be written before Apply, got %v", created, err)
+	}
+	if ok, err := cs.Exists(created); err != nil || !ok {
+		t.Errorf("expected staged file %s to exist, got %v, %v", created, ok, err)
+	}
+	staged, err := cs.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(staged) != "buildID: 1\nfoo:\n  image: {}\n" {
+		t.Errorf("unexpected staged content: %q", staged)
+	}
+
+	if err := cs.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello\n" {
+		t.Errorf("expected 'hello', got %q", b)
+	}
+	fi, err := os.Stat(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode of %s to be preserved, got %v", existing, fi.Mode())
+	}
+}
+
+func TestChangesOmitsUnmodifiedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changeset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "routes")
+	if err := ioutil.WriteFile(path, []byte("/ static 8080 /\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := New()
+	if err := cs.WriteFile(path, []byte("/ static 8080 /\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Changes()) != 0 {
+		t.Errorf("expected no changes, got %v", cs.Changes())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change Change
+		want   string
+	}{
+		{
+			name:   "create",
+			change: Change{Path: "foo/Dockerfile", After: []byte("FROM node:8\nEXPOSE 8080\n")},
+			want: `--- /dev/null
++++ b/foo/Dockerfile
+@@ -0,0 +1,2 @@
++FROM node:8
++EXPOSE 8080
+`,
+		},
+		{
+			name: "insert",
+			change: Change{
+				Path:   "config/routes",
+				Before: []byte("/api/\tapi\t8080\n/\tstatic\t8080\t/\n"),
+				After:  []byte("/api/\tapi\t8080\n/foo/\tfoo\t8080\n/\tstatic\t8080\t/\n"),
+			},
+			want: `--- a/config/routes
++++ b/config/routes
+@@ -1,2 +1,3 @@
+ /api/	api	8080
++/foo/	foo	8080
+ /	static	8080	/
+`,
+		},
+		{
+			name: "missing newline",
+			change: Change{
+				Path:   "values.yaml",
+				Before: []byte("buildID: 1"),
+				After:  []byte("buildID: 1\nfoo: {}\n"),
+			},
+			want: `--- a/values.yaml
++++ b/values.yaml
+@@ -1 +1,2 @@
+-buildID: 1
+\ No newline at end of file
++buildID: 1
++foo: {}
+`,
+		},
+		{
+			name: "separate hunks",
+			change: Change{
+				Path:   "f",
+				Before: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"),
+				After:  []byte("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n"),
+			},
+			want: `--- a/f
++++ b/f
+@@ -1,3 +1,4 @@
++0
+ 1
+ 2
+ 3
+@@ -7,4 +8,3 @@
+ 7
+ 8
+ 9
+-10
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		if err := tt.change.Diff(buf); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.name, tt.want, buf.String())
+		}
+	}
+}
+
+func TestApplyRollsBackOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changeset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	values := filepath.Join(dir, "values.yaml")
+	if err := ioutil.WriteFile(values, []byte("buildID: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := New()
+	cs.MkdirAll(filepath.Join(dir, "foo"), 0755)
+	if err := cs.WriteFile(filepath.Join(dir, "foo", "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.AppendFile(values, []byte("foo: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blocked := filepath.Join(dir, "zzz", "routes")
+	if err := cs.WriteFile(blocked, []byte("/foo/\tfoo\t8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a non-empty directory in place of the last file makes moving it into place fail
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cs.Apply(); err == nil {
+		t.Fatal("expected Apply to fail")
+	}
+
+	b, err := ioutil.ReadFile(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "buildID: 1\n" {
+		t.Errorf("expected values.yaml to be restored, got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "foo")); !os.IsNotExist(err) {
+		t.Errorf("expected created directory foo to be removed, got %v", err)
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "zzz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "routes" {
+		t.Errorf("expected temporary files to be cleaned up, got %v", files)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changeset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	link := filepath.Join(dir, "bin", "run")
+	replaced := filepath.Join(dir, "replaced")
+	if err := os.Symlink("target", replaced); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := New()
+	if err := cs.WriteFile(filepath.Join(dir, "bin", "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Symlink("run.sh", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.WriteFile(replaced, []byte("no longer a link\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := cs.ReadFile(link); err != nil || string(b) != "#!/bin/sh\n" {
+		t.Errorf("expected reading the staged symlink to follow it, got %q, %v", b, err)
+	}
+	if target, err := cs.ReadLink(link); err != nil || target != "run.sh" {
+		t.Errorf("expected the staged symlink to point to run.sh, got %q, %v", target, err)
+	}
+	if ok, err := cs.Exists(replaced); err != nil || !ok {
+		t.Errorf("expected a dangling symlink to exist, got %v, %v", ok, err)
+	}
+	loop := filepath.Join(dir, "loop")
+	if err := cs.Symlink("loop2", loop); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Symlink("loop", loop+"2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.ReadFile(loop); !errors.Is(err, vfs.ErrTooManyLinks) {
+		t.Errorf("expected vfs.ErrTooManyLinks reading a symlink loop, got %v", err)
+	}
+	for _, p := range []string{loop, loop + "2"} {
+		if err := cs.Remove(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cs.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(link); err != nil || target != "run.sh" {
+		t.Errorf("expected %s to be a symlink to run.sh, got %q, %v", link, target, err)
+	}
+	fi, err := os.Lstat(replaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.Mode().IsRegular() {
+		t.Errorf("expected the symlink %s to be replaced by a regular file, got %v", replaced, fi.Mode())
+	}
+
+	// rolling back restores the symlink that was replaced
+	cs = New()
+	if err := cs.Symlink("elsewhere", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.WriteFile(filepath.Join(dir, "zzz"), []byte("blocked\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "zzz", "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Apply(); err == nil {
+		t.Fatal("expected Apply to fail")
+	}
+	if target, err := os.Readlink(link); err != nil || target != "run.sh" {
+		t.Errorf("expected %s to be restored as a symlink to run.sh, got %q, %v", link, target, err)
+	}
+}
+
+func TestApplyToMemFS(t *testing.T) {
+	m := vfs.NewMemFS()
+	if err := m.WriteFile("values.yaml", []byte("buildID: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := NewFS(m)
+	if err := cs.WriteFile(filepath.Join("nested", "new.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.AppendFile("values.yaml", []byte("foo: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := m.ReadFile(filepath.Join("nested", "new.txt")); err != nil || string(b) != "hello\n" {
+		t.Errorf("expected nested/new.txt to be written, got %q, %v", b, err)
+	}
+	if b, err := m.ReadFile("values.yaml"); err != nil || string(b) != "buildID: 1\nfoo: {}\n" {
+		t.Errorf("expected values.yaml to be appended to, got %q, %v", b, err)
+	}
+	if fi, err := m.Stat("values.yaml"); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected values.yaml to keep its mode, got %v, %v", fi, err)
+	}
+	if _, err := os.Stat("values.yaml"); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written to disk, got %v", err)
+	}
+}
+
+func TestFS(t *testing.T) {
+	m := vfs.NewMemFS()
+	if err := m.Mkdir("app", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"main.go": "package main\n", "old.txt": "old\n"} {
+		if err := m.WriteFile(filepath.Join("app", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Symlink("main.go", filepath.Join("app", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := NewFS(m)
+	staged := cs.FS()
+	main := filepath.Join("app", "main.go")
+	if err := staged.Rename(main, main+".bak"); err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.WriteFile(main, []byte("package app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Chmod(main, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Remove(filepath.Join("app", "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.MkdirAll(filepath.Join("app", "new", "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.WriteFile(filepath.Join("app", "new", "sub", "f.txt"), []byte("f\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := staged.Symlink("main.go", filepath.Join("app", "link")); !os.IsExist(err) {
+		t.Errorf("expected an error creating a symlink over an existing file, got %v", err)
+	}
+
+	var paths []string
+	err := fs.WalkDir(staged, "app", func(path string, d fs.DirEntry, err error) error {
+		paths = append(paths, filepath.ToSlash(path))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"app", "app/link", "app/main.go", "app/main.go.bak", "app/new", "app/new/sub", "app/new/sub/f.txt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected the staged files %v, got %v", want, paths)
+	}
+	// the symlink on disk points to the staged file
+	if fi, err := staged.Stat(filepath.Join("app", "link")); err != nil || fi.Mode().Perm() != 0755 || fi.Size() != int64(len("package app\n")) {
+		t.Errorf("expected app/link to resolve to the staged app/main.go, got %v, %v", fi, err)
+	}
+	if b, err := fs.ReadFile(staged, main+".bak"); err != nil || string(b) != "package main\n" {
+		t.Errorf("expected app/main.go to be backed up, got %q, %v", b, err)
+	}
+	if _, err := m.Stat(filepath.Join("app", "new")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written before Apply, got %v", err)
+	}
+
+	if err := cs.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := m.Stat(main); err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("expected app/main.go to be written with mode 0755, got %v, %v", fi, err)
+	}
+	if fi, err := m.Stat(filepath.Join("app", "new", "sub")); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("expected app/new/sub to be created with mode 0700, got %v, %v", fi, err)
+	}
+	if _, err := m.Stat(filepath.Join("app", "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected app/old.txt to be removed, got %v", err)
+	}
+}
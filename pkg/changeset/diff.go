@@ -0,0 +1,179 @@
+package changeset
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// diffContext is the number of unchanged lines shown around each hunk.
+const diffContext = 3
+
+// edit is a single step in a line-based edit script.
+//
+// a and b are the (0-indexed) positions in the old and new lines at which the step applies.
+type edit struct {
+	op   byte
+	a, b int
+}
+
+// Diff writes the staged changes to w as a unified diff.
+func (c *Changeset) Diff(w io.Writer) error {
+	for _, ch := range c.Changes() {
+		if err := ch.Diff(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff writes the change to w as a unified diff.
+func (c *Change) Diff(w io.Writer) error {
+	oldName, newName := "a/"+filepath.ToSlash(c.Path), "b/"+filepath.ToSlash(c.Path)
+	if c.Created() {
+		oldName = "/dev/null"
+	}
+	if c.Deleted {
+		newName = "/dev/null"
+	}
+	if isBinary(c.Before) || isBinary(c.After) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", oldName, newName)
+		return err
+	}
+
+	a, b := splitLines(c.Before), splitLines(c.After)
+	edits := diffLines(a, b)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(edits) {
+		writeHunk(buf, a, b, edits[h[0]:h[1]])
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// splitLines splits data into lines, keeping the trailing newline on each line so that a
+// missing newline at the end of the file counts as a difference.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// diffLines computes the edit script turning a into b from their longest common subsequence.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			edits = append(edits, edit{' ', i, j})
+			i++
+			j++
+		case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', i, j})
+			j++
+		}
+	}
+	return edits
+}
+
+// hunks groups the changed steps in edits into hunks, returning the [start, end) range of each
+// hunk including its surrounding context.
+func hunks(edits []edit) [][2]int {
+	var result [][2]int
+	for i := 0; i < len(edits); i++ {
+		if edits[i].op == ' ' {
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk while the next change is close enough for the context to overlap
+		end, unchanged := i+1, 0
+		for ; end < len(edits) && unchanged <= 2*diffContext; end++ {
+			if edits[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		if unchanged > diffContext {
+			end -= unchanged - diffContext
+		}
+		result = append(result, [2]int{start, end})
+		i = end - 1
+	}
+	return result
+}
+
+func writeHunk(buf *bytes.Buffer, a, b []string, edits []edit) {
+	var oldLen, newLen int
+	for _, e := range edits {
+		if e.op != '+' {
+			oldLen++
+		}
+		if e.op != '-' {
+			newLen++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(edits[0].a, oldLen), hunkRange(edits[0].b, newLen))
+	for _, e := range edits {
+		var line string
+		if e.op == '+' {
+			line = b[e.b]
+		} else {
+			line = a[e.a]
+		}
+		buf.WriteByte(e.op)
+		buf.WriteString(line)
+		if line == "" || line[len(line)-1] != '\n' {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,312 @@
+package changeset
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+var errDirRename = errors.New("renaming a directory cannot be staged")
+
+// FS returns the changeset as a file system: reads see the staged changes on top of the files
+// they change, and writes are staged instead of written. Directories holding staged files exist
+// in it even if they do not exist yet. Directories cannot be renamed, and the modes of existing
+// directories cannot be changed.
+func (c *Changeset) FS() vfs.FS {
+	return stagedFS{c}
+}
+
+type stagedFS struct {
+	c *Changeset
+}
+
+// Open opens the named file for reading.
+func (s stagedFS) Open(name string) (fs.File, error) {
+	fi, err := s.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		entries, err := s.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return vfs.NewHandle(fi, nil, entries), nil
+	}
+	b, err := s.c.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return vfs.NewHandle(fi, b, nil), nil
+}
+
+// Stat returns a FileInfo describing the named file, following symlinks.
+func (s stagedFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := s.c.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return s.Lstat(path)
+}
+
+// Lstat returns a FileInfo describing the named file, without following a final symlink.
+func (s stagedFS) Lstat(name string) (fs.FileInfo, error) {
+	c := s.c
+	path := filepath.Clean(name)
+	if ch, ok := c.changes[path]; ok {
+		if ch.Deleted {
+			return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+		}
+		return changeInfo{ch}, nil
+	}
+	mode, staged := c.stagedDir(path)
+	fi, err := c.fsys.Lstat(path)
+	switch {
+	case os.IsNotExist(err) && staged:
+		return dirInfo{name: filepath.Base(path), mode: mode}, nil
+	case err != nil:
+		return nil, err
+	case fi.IsDir() && !staged:
+		if _, removed := c.rmdirs[path]; removed {
+			return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+		}
+	}
+	return fi, nil
+}
+
+// stagedDir returns the mode of the directory at path if it is staged to be created, either
+// explicitly or because it holds a staged file or directory.
+func (c *Changeset) stagedDir(path string) (os.FileMode, bool) {
+	if mode, ok := c.dirs[path]; ok {
+		return mode, true
+	}
+	prefix := path + string(filepath.Separator)
+	for p, ch := range c.changes {
+		if !ch.Deleted && strings.HasPrefix(p, prefix) {
+			return 0755, true
+		}
+	}
+	for p := range c.dirs {
+		if strings.HasPrefix(p, prefix) {
+			return 0755, true
+		}
+	}
+	return 0, false
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (s stagedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fi, err := s.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	path, err := s.c.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	if entries, err := s.c.fsys.ReadDir(path); err == nil {
+		for _, e := range entries {
+			names[e.Name()] = true
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	prefix := path + string(filepath.Separator)
+	staged := func(p string) {
+		if strings.HasPrefix(p, prefix) {
+			names[strings.SplitN(p[len(prefix):], string(filepath.Separator), 2)[0]] = true
+		}
+	}
+	for p := range s.c.changes {
+		staged(p)
+	}
+	for p := range s.c.dirs {
+		staged(p)
+	}
+
+	var entries []fs.DirEntry
+	for n := range names {
+		fi, err := s.Lstat(filepath.Join(path, n))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ReadFile returns the staged content of the named file.
+func (s stagedFS) ReadFile(name string) ([]byte, error) {
+	return s.c.ReadFile(name)
+}
+
+// ReadLink returns the staged target of the named symlink.
+func (s stagedFS) ReadLink(name string) (string, error) {
+	return s.c.ReadLink(name)
+}
+
+// WriteFile stages data to be written to the named file. The mode of an existing file is kept.
+func (s stagedFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return s.c.WriteFile(name, data, perm)
+}
+
+// Mkdir stages the named directory to be created.
+func (s stagedFS) Mkdir(name string, perm fs.FileMode) error {
+	if _, err := s.Lstat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	s.c.MkdirAll(name, perm.Perm())
+	return nil
+}
+
+// MkdirAll stages the named directory to be created, along with any missing parents.
+func (s stagedFS) MkdirAll(name string, perm fs.FileMode) error {
+	fi, err := s.Stat(name)
+	switch {
+	case err == nil && fi.IsDir():
+		return nil
+	case err == nil:
+		return &os.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+	case !os.IsNotExist(err):
+		return err
+	}
+	s.c.MkdirAll(name, perm.Perm())
+	return nil
+}
+
+// Symlink stages newname to be created as a symlink to oldname.
+func (s stagedFS) Symlink(oldname, newname string) error {
+	if _, err := s.Lstat(newname); err == nil {
+		return &os.PathError{Op: "symlink", Path: newname, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return s.c.Symlink(oldname, newname)
+}
+
+// Rename stages the file at oldname to be moved to newname, replacing newname if it exists.
+func (s stagedFS) Rename(oldname, newname string) error {
+	fi, err := s.Lstat(oldname)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.IsDir():
+		return &os.PathError{Op: "rename", Path: oldname, Err: errDirRename}
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := s.c.ReadLink(oldname)
+		if err != nil {
+			return err
+		}
+		if err := s.c.Symlink(target, newname); err != nil {
+			return err
+		}
+	default:
+		b, err := s.c.ReadFile(oldname)
+		if err != nil {
+			return err
+		}
+		if err := s.c.WriteFile(newname, b, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := s.Chmod(newname, fi.Mode()); err != nil {
+			return err
+		}
+	}
+	return s.c.Remove(oldname)
+}
+
+// Remove stages the named file or empty directory to be removed.
+func (s stagedFS) Remove(name string) error {
+	fi, err := s.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return s.c.Remove(name)
+	}
+	if entries, err := s.ReadDir(name); err != nil {
+		return err
+	} else if len(entries) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	path := filepath.Clean(name)
+	if _, ok := s.c.dirs[path]; ok {
+		delete(s.c.dirs, path)
+		return nil
+	}
+	s.c.rmdirs[path] = fi.Mode().Perm()
+	return nil
+}
+
+// Chmod stages the permission bits of the named file to be changed to those of mode.
+func (s stagedFS) Chmod(name string, mode fs.FileMode) error {
+	c := s.c
+	path, err := c.resolve("chmod", name)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.dirs[path]; ok {
+		c.dirs[path] = mode.Perm()
+		return nil
+	}
+	fi, err := s.Lstat(path)
+	switch {
+	case err != nil:
+		return err
+	case fi.IsDir():
+		return &os.PathError{Op: "chmod", Path: name, Err: errors.New("changing the mode of an existing directory cannot be staged")}
+	}
+	_, staged := c.changes[path]
+	ch, err := c.change(path, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if !staged {
+		// the content is left as it is
+		ch.After = ch.Before
+	}
+	ch.Mode = mode.Perm()
+	return nil
+}
+
+// changeInfo describes the file a staged change leaves at its path.
+type changeInfo struct {
+	ch *Change
+}
+
+func (i changeInfo) Name() string       { return filepath.Base(i.ch.Path) }
+func (i changeInfo) Size() int64        { return int64(len(i.ch.After)) }
+func (i changeInfo) Mode() fs.FileMode  { return i.ch.Mode }
+func (i changeInfo) ModTime() time.Time { return time.Time{} }
+func (i changeInfo) IsDir() bool        { return false }
+func (i changeInfo) Sys() interface{}   { return nil }
+
+// dirInfo describes a directory that is staged to be created.
+type dirInfo struct {
+	name string
+	mode os.FileMode
+}
+
+func (i dirInfo) Name() string       { return i.name }
+func (i dirInfo) Size() int64        { return 0 }
+func (i dirInfo) Mode() fs.FileMode  { return fs.ModeDir | i.mode }
+func (i dirInfo) ModTime() time.Time { return time.Time{} }
+func (i dirInfo) IsDir() bool        { return true }
+func (i dirInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,158 @@
+package changeset
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// transaction records everything Apply has done to the file system so far, so that it can be
+// undone if a later step fails.
+type transaction struct {
+	fsys vfs.FS
+	// dirs are the directories created, in creation order.
+	dirs []string
+	// temps are the temporary files holding new content that were not moved into place yet.
+	temps map[string]bool
+	// applied are the changes that were already moved into place.
+	applied []*Change
+	// removed are the directories removed, in removal order.
+	removed []removedDir
+}
+
+type removedDir struct {
+	path string
+	mode os.FileMode
+}
+
+func newTransaction(fsys vfs.FS) *transaction {
+	return &transaction{fsys: fsys, temps: make(map[string]bool)}
+}
+
+// mkdirAll creates dir along with any missing parents, recording each directory it creates.
+func (t *transaction) mkdirAll(dir string, mode os.FileMode) error {
+	var missing []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		fi, err := t.fsys.Stat(d)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s is not a directory", d)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		missing = append(missing, d)
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := t.fsys.Mkdir(missing[i], mode); err != nil {
+			return err
+		}
+		t.dirs = append(t.dirs, missing[i])
+	}
+	return nil
+}
+
+// writeTemp writes the new content of ch to a temporary file in the same directory as its
+// destination, so that it can later be renamed into place.
+func (t *transaction) writeTemp(ch *Change) (string, error) {
+	tmp, err := t.tempName(ch.Path)
+	if err != nil {
+		return "", err
+	}
+	t.temps[tmp] = true
+	if ch.IsSymlink() {
+		return tmp, t.fsys.Symlink(string(ch.After), tmp)
+	}
+	if err := t.fsys.WriteFile(tmp, ch.After, ch.Mode); err != nil {
+		return "", err
+	}
+	return tmp, t.fsys.Chmod(tmp, ch.Mode)
+}
+
+// tempName returns the name of a file that does not exist yet, next to path.
+func (t *transaction) tempName(path string) (string, error) {
+	for i := 0; i < 10000; i++ {
+		name := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp"+strconv.Itoa(int(rand.Uint32())))
+		if _, err := t.fsys.Lstat(name); os.IsNotExist(err) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("could not find a temporary file name next to %s", path)
+}
+
+// commit moves the temporary file tmp into place as ch.Path, or removes ch.Path if the change
+// deletes it.
+func (t *transaction) commit(tmp string, ch *Change) error {
+	if ch.Deleted {
+		if err := t.fsys.Remove(ch.Path); err != nil {
+			return err
+		}
+	} else {
+		if err := t.fsys.Rename(tmp, ch.Path); err != nil {
+			return err
+		}
+		delete(t.temps, tmp)
+	}
+	t.applied = append(t.applied, ch)
+	return nil
+}
+
+// rmdir removes the empty directory dir.
+func (t *transaction) rmdir(dir string, mode os.FileMode) error {
+	if err := t.fsys.Remove(dir); err != nil {
+		return err
+	}
+	t.removed = append(t.removed, removedDir{dir, mode})
+	return nil
+}
+
+// rollback undoes every recorded step in reverse order. It carries on past failures and
+// returns the first error encountered.
+func (t *transaction) rollback() error {
+	var rerr error
+	keep := func(err error) {
+		if err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	for tmp := range t.temps {
+		keep(t.fsys.Remove(tmp))
+	}
+	for i := len(t.removed) - 1; i >= 0; i-- {
+		keep(t.fsys.Mkdir(t.removed[i].path, t.removed[i].mode))
+	}
+	for i := len(t.applied) - 1; i >= 0; i-- {
+		ch := t.applied[i]
+		if ch.Created() {
+			keep(t.fsys.Remove(ch.Path))
+		} else {
+			keep(t.restore(ch))
+		}
+	}
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		keep(t.fsys.Remove(t.dirs[i]))
+	}
+	return rerr
+}
+
+// restore puts the file ch.Path back the way it was before ch was applied.
+func (t *transaction) restore(ch *Change) error {
+	if err := t.fsys.Remove(ch.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if ch.beforeMode&os.ModeSymlink != 0 {
+		return t.fsys.Symlink(string(ch.Before), ch.Path)
+	}
+	return t.fsys.WriteFile(ch.Path, ch.Before, ch.beforeMode.Perm())
+}
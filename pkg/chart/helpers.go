@@ -0,0 +1,183 @@
+package chart
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Define is a named template definition found in a helpers file.
+type Define struct {
+	// Name is the name of the template.
+	Name string
+	// Text is the definition, from its define action through its end action.
+	Text string
+	// Start and End are the byte offsets of the definition in the file.
+	Start, End int
+	// Line is the (1-indexed) line the definition starts on.
+	Line int
+}
+
+// DefineConflictError is returned when a helpers file already defines a template with a
+// different definition than the one being merged.
+type DefineConflictError struct {
+	// Name is the name of the conflicting template.
+	Name string
+	// Line is the (1-indexed) line the existing definition starts on.
+	Line int
+}
+
+func (e *DefineConflictError) Error() string {
+	return fmt.Sprintf("template %q is already defined on line %d with a different definition", e.Name, e.Line)
+}
+
+// ParseDefines returns the top-level template definitions in content, in the order they appear.
+func ParseDefines(content []byte) ([]Define, error) {
+	s := string(content)
+	var (
+		defines []Define
+		current *Define
+		depth   int
+	)
+	for pos := 0; ; {
+		i := strings.Index(s[pos:], "{{")
+		if i < 0 {
+			break
+		}
+		start := pos + i
+		j := strings.Index(s[start:], "}}")
+		if j < 0 {
+			return nil, fmt.Errorf("line %d: unclosed action", lineAt(s, start))
+		}
+		end := start + j + 2
+		pos = end
+
+		action := actionText(s[start+2 : end-2])
+		if strings.HasPrefix(action, "/*") {
+			continue
+		}
+		fields := strings.Fields(action)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "define", "block":
+			if depth == 0 {
+				name, err := templateName(strings.TrimSpace(action[len(fields[0]):]))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineAt(s, start), err)
+				}
+				current = &Define{Name: name, Start: start, Line: lineAt(s, start)}
+			}
+			depth++
+		case "if", "range", "with":
+			depth++
+		case "end":
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("line %d: unexpected end", lineAt(s, start))
+			}
+			if depth == 0 && current != nil {
+				current.End = end
+				current.Text = s[current.Start:end]
+				defines = append(defines, *current)
+				current = nil
+			}
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("line %d: template %q is missing its end", current.Line, current.Name)
+	}
+	return defines, nil
+}
+
+// MergeHelpers merges the template definitions in block into the helpers file content.
+//
+// Definitions that are missing are appended to the content and identical ones are skipped,
+// so merging the same block twice leaves the content unchanged. If a template is already
+// defined differently, a *DefineConflictError is returned.
+func MergeHelpers(content, block []byte) ([]byte, error) {
+	existing, err := ParseDefines(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse helpers: %v", err)
+	}
+	merging, err := ParseDefines(block)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse helpers to merge: %v", err)
+	}
+
+	merged := content
+	for _, d := range merging {
+		if e, found := findDefine(existing, d.Name); found {
+			if e.Text != d.Text {
+				return nil, &DefineConflictError{Name: d.Name, Line: e.Line}
+			}
+			continue
+		}
+		merged = appendSection(merged, []byte(d.Text+"\n"))
+	}
+	return merged, nil
+}
+
+// RemoveDefine removes the named template definition from the helpers file content, along
+// with the blank line separating it from the previous definition.
+func RemoveDefine(content []byte, name string) ([]byte, error) {
+	defines, err := ParseDefines(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse helpers: %v", err)
+	}
+	d, found := findDefine(defines, name)
+	if !found {
+		return content, nil
+	}
+	start, end := d.Start, d.End
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	if start >= 2 && content[start-1] == '\n' && content[start-2] == '\n' {
+		start--
+	}
+	return append(content[:start:start], content[end:]...), nil
+}
+
+func findDefine(defines []Define, name string) (Define, bool) {
+	for _, d := range defines {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Define{}, false
+}
+
+// actionText returns the text of an action, without its trim markers and surrounding spaces.
+func actionText(action string) string {
+	if strings.HasPrefix(action, "- ") {
+		action = action[1:]
+	}
+	if strings.HasSuffix(action, " -") {
+		action = action[:len(action)-1]
+	}
+	return strings.TrimSpace(action)
+}
+
+// templateName parses the quoted template name at the start of s.
+func templateName(s string) (string, error) {
+	if s == "" || (s[0] != '"' && s[0] != '`') {
+		return "", fmt.Errorf("expected a quoted template name, got %q", s)
+	}
+	end := 1
+	for ; end < len(s) && s[end] != s[0]; end++ {
+		if s[0] == '"' && s[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(s) {
+		return "", fmt.Errorf("unterminated template name %s", s)
+	}
+	return strconv.Unquote(s[:end+1])
+}
+
+// lineAt returns the (1-indexed) line of the byte offset in s.
+func lineAt(s string, offset int) int {
+	return strings.Count(s[:offset], "\n") + 1
+}
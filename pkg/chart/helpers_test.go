@@ -0,0 +1,91 @@
+package chart
+
+import (
+	"testing"
+)
+
+const (
+	testHelpers = `{{/* vim: set filetype=mustache: */}}
+{{/*
+Expand the name of the chart.
+*/}}
+{{- define "myapp.name" -}}
+{{- if .Values.nameOverride -}}
+{{- .Values.nameOverride | trunc 63 | trimSuffix "-" -}}
+{{- else -}}
+{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+{{- end -}}
+`
+	fooHelper = `
+{{- define "myapp.foo.name" -}}
+{{- printf "%s-foo" .Release.Name | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+`
+)
+
+func TestParseDefines(t *testing.T) {
+	defines, err := ParseDefines([]byte(testHelpers + fooHelper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defines) != 2 {
+		t.Fatalf("expected 2 definitions, got %d: %v", len(defines), defines)
+	}
+	if defines[0].Name != "myapp.name" || defines[0].Line != 5 {
+		t.Errorf("expected myapp.name on line 5, got %s on line %d", defines[0].Name, defines[0].Line)
+	}
+	if defines[1].Name != "myapp.foo.name" || defines[1].Line != 13 {
+		t.Errorf("expected myapp.foo.name on line 13, got %s on line %d", defines[1].Name, defines[1].Line)
+	}
+
+	for _, invalid := range []string{
+		`{{- define "foo" -}}`,
+		`{{- define foo -}}{{- end -}}`,
+		`{{- end -}}`,
+		`{{- define "foo" -}`,
+	} {
+		if _, err := ParseDefines([]byte(invalid)); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestMergeHelpers(t *testing.T) {
+	merged, err := MergeHelpers([]byte(testHelpers), []byte(fooHelper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testHelpers + fooHelper; string(merged) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, merged)
+	}
+
+	// merging the same definition again is a no-op
+	again, err := MergeHelpers(merged, []byte(fooHelper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(merged) {
+		t.Errorf("expected merging twice to leave the helpers unchanged, got\n%s", again)
+	}
+
+	conflicting := `{{- define "myapp.foo.name" -}}foo{{- end -}}`
+	_, err = MergeHelpers(merged, []byte(conflicting))
+	conflict, ok := err.(*DefineConflictError)
+	if !ok {
+		t.Fatalf("expected a *DefineConflictError, got %v", err)
+	}
+	if conflict.Name != "myapp.foo.name" || conflict.Line != 13 {
+		t.Errorf("expected conflict on myapp.foo.name at line 13, got %s at line %d", conflict.Name, conflict.Line)
+	}
+}
+
+func TestRemoveDefine(t *testing.T) {
+	removed, err := RemoveDefine([]byte(testHelpers+fooHelper), "myapp.foo.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(removed) != testHelpers {
+		t.Errorf("expected\n%s\ngot\n%s", testHelpers, removed)
+	}
+}
@@ -0,0 +1,192 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ValuesConflictError is returned when a values file already has a top-level key with content
+// that conflicts with the content being merged.
+type ValuesConflictError struct {
+	// Key is the conflicting top-level key.
+	Key string
+	// Line is the (1-indexed) line the key is found on.
+	Line int
+}
+
+func (e *ValuesConflictError) Error() string {
+	return fmt.Sprintf("key %q already exists on line %d with conflicting content", e.Key, e.Line)
+}
+
+// section is the range of lines [start, end) holding a top-level key and its value.
+type section struct {
+	key        string
+	start, end int
+}
+
+// MergeValues merges the top-level keys of block into the values file content.
+//
+// The content is left as-is, including its comments and key order: keys that are missing are
+// appended to it, and keys that already exist are left alone as long as they contain everything
+// in block. If an existing key has conflicting content, a *ValuesConflictError is returned.
+func MergeValues(content, block []byte) ([]byte, error) {
+	existing := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(content, &existing); err != nil {
+		return nil, fmt.Errorf("could not parse values: %v", err)
+	}
+	merging := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(block, &merging); err != nil {
+		return nil, fmt.Errorf("could not parse values to merge: %v", err)
+	}
+
+	lines := splitLines(content)
+	blockLines := splitLines(block)
+	merged := content
+	for _, s := range sections(blockLines) {
+		value, ok := existing[s.key]
+		if !ok {
+			merged = appendSection(merged, []byte(strings.Join(blockLines[s.start:s.end], "")))
+			continue
+		}
+		if !contains(value, merging[s.key]) {
+			line := 0
+			if e, found := findSection(lines, s.key); found {
+				line = e.start + 1
+			}
+			return nil, &ValuesConflictError{Key: s.key, Line: line}
+		}
+	}
+	return merged, nil
+}
+
+// RemoveValues removes the top-level key from the values file content, along with the blank
+// line separating it from the previous key. The rest of the content is left as-is.
+func RemoveValues(content []byte, key string) []byte {
+	lines := splitLines(content)
+	s, found := findSection(lines, key)
+	if !found {
+		return content
+	}
+	start := s.start
+	if start > 0 && strings.TrimSpace(lines[start-1]) == "" {
+		start--
+	}
+	return []byte(strings.Join(append(lines[:start], lines[s.end:]...), ""))
+}
+
+// appendSection appends a section to content, separated from the previous key by a blank line.
+func appendSection(content, s []byte) []byte {
+	if len(content) == 0 {
+		return s
+	}
+	out := append([]byte{}, content...)
+	if !bytes.HasSuffix(out, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	if !bytes.HasSuffix(out, []byte("\n\n")) {
+		out = append(out, '\n')
+	}
+	if !bytes.HasSuffix(s, []byte("\n")) {
+		s = append(s, '\n')
+	}
+	return append(out, s...)
+}
+
+// contains reports whether the existing value holds everything in want.
+func contains(existing, want interface{}) bool {
+	w, ok := want.(map[interface{}]interface{})
+	if !ok {
+		return reflect.DeepEqual(existing, want)
+	}
+	if existing == nil && len(w) == 0 {
+		return true
+	}
+	e, ok := existing.(map[interface{}]interface{})
+	if !ok {
+		return false
+	}
+	for k, v := range w {
+		ev, ok := e[k]
+		if !ok || !contains(ev, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// findSection finds the section holding the top-level key.
+func findSection(lines []string, key string) (section, bool) {
+	for _, s := range sections(lines) {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return section{}, false
+}
+
+// sections splits lines into the sections holding each top-level key. A section ends at the
+// next line starting at the first column, not counting the blank lines in front of it.
+func sections(lines []string) []section {
+	var result []section
+	for i := 0; i < len(lines); i++ {
+		key, ok := topLevelKey(lines[i])
+		if !ok {
+			continue
+		}
+		end := i + 1
+		for ; end < len(lines); end++ {
+			line := lines[end]
+			if strings.TrimSpace(line) != "" && line[0] != ' ' && line[0] != '\t' {
+				break
+			}
+		}
+		for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		result = append(result, section{key: key, start: i, end: end})
+		i = end - 1
+	}
+	return result
+}
+
+// topLevelKey returns the key defined on line if it is a top-level mapping key.
+func topLevelKey(line string) (string, bool) {
+	if line == "" || strings.ContainsRune(" \t\r\n#-.", rune(line[0])) {
+		return "", false
+	}
+	var key, rest string
+	if q := line[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(line[1:], q)
+		if end < 0 {
+			return "", false
+		}
+		key, rest = line[1:end+1], line[end+2:]
+	} else {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return "", false
+		}
+		key, rest = strings.TrimSpace(line[:i]), line[i:]
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if !strings.HasPrefix(rest, ":") {
+		return "", false
+	}
+	if rest = rest[1:]; rest != "" && !strings.ContainsRune(" \t\r\n", rune(rest[0])) {
+		return "", false
+	}
+	return key, true
+}
+
+// splitLines splits content into lines, keeping the line endings.
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,117 @@
+package chart
+
+import (
+	"testing"
+)
+
+const fooValues = `
+foo:
+  image: {}
+`
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "empty",
+			content: "",
+			want:    "foo:\n  image: {}\n",
+		},
+		{
+			name: "append preserving comments",
+			content: `# the build ID is set by kubed
+buildID: 1 # inline comment
+
+bar:
+  image: {}
+`,
+			want: `# the build ID is set by kubed
+buildID: 1 # inline comment
+
+bar:
+  image: {}
+
+foo:
+  image: {}
+`,
+		},
+		{
+			name:    "missing trailing newline",
+			content: "buildID: 1",
+			want:    "buildID: 1\n\nfoo:\n  image: {}\n",
+		},
+		{
+			name:    "already merged",
+			content: "buildID: 1\n\nfoo:\n  image: {}\n",
+			want:    "buildID: 1\n\nfoo:\n  image: {}\n",
+		},
+		{
+			name: "already merged with customisations",
+			content: `foo:
+  replicaCount: 3
+  image:
+    repository: example.com/foo
+`,
+			want: `foo:
+  replicaCount: 3
+  image:
+    repository: example.com/foo
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := MergeValues([]byte(tt.content), []byte(fooValues))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: expected\n%q\ngot\n%q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestMergeValuesConflict(t *testing.T) {
+	content := "buildID: 1\n\"foo\": bar\n"
+	_, err := MergeValues([]byte(content), []byte(fooValues))
+	conflict, ok := err.(*ValuesConflictError)
+	if !ok {
+		t.Fatalf("expected a *ValuesConflictError, got %v", err)
+	}
+	if conflict.Key != "foo" || conflict.Line != 2 {
+		t.Errorf("expected conflict on key foo at line 2, got %q at line %d", conflict.Key, conflict.Line)
+	}
+
+	if _, err := MergeValues([]byte("foo: [\n"), []byte(fooValues)); err == nil {
+		t.Error("expected an error for invalid YAML")
+	}
+}
+
+func TestRemoveValues(t *testing.T) {
+	content := `buildID: 1
+
+foo:
+  image: {}
+  # a comment inside the block
+
+# the bar controller
+bar:
+  image: {}
+`
+	want := `buildID: 1
+
+# the bar controller
+bar:
+  image: {}
+`
+	if got := string(RemoveValues([]byte(content), "foo")); got != want {
+		t.Errorf("expected\n%q\ngot\n%q", want, got)
+	}
+	if got := string(RemoveValues([]byte(content), "baz")); got != content {
+		t.Errorf("expected content to be unchanged, got %q", got)
+	}
+}
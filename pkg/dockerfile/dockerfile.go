@@ -0,0 +1,261 @@
+// Package dockerfile parses Dockerfiles into their instructions and build stages, keeping track
+// of the line each instruction is on.
+package dockerfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// commands are the instructions a Dockerfile may hold.
+var commands = map[string]bool{
+	"ADD": true, "ARG": true, "CMD": true, "COPY": true, "ENTRYPOINT": true, "ENV": true,
+	"EXPOSE": true, "FROM": true, "HEALTHCHECK": true, "LABEL": true, "MAINTAINER": true,
+	"ONBUILD": true, "RUN": true, "SHELL": true, "STOPSIGNAL": true, "USER": true,
+	"VOLUME": true, "WORKDIR": true,
+}
+
+// flagCommands are the instructions that take options, such as "COPY --from=build".
+var flagCommands = map[string]bool{
+	"ADD": true, "COPY": true, "FROM": true, "HEALTHCHECK": true, "RUN": true,
+}
+
+// directive matches a parser directive, such as "# escape=`".
+var directive = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.+?)\s*$`)
+
+// Dockerfile is a parsed Dockerfile.
+type Dockerfile struct {
+	// Instructions are all the instructions of the Dockerfile, in order.
+	Instructions []Instruction
+	// Stages are the build stages of the Dockerfile, in order. The last one is the image that is
+	// built.
+	Stages []Stage
+}
+
+// Instruction is an instruction of a Dockerfile.
+type Instruction struct {
+	// Command is the keyword of the instruction, upper-cased, e.g. "FROM".
+	Command string
+	// Flags are the options given to the instruction before its arguments, e.g. "--from=build".
+	Flags []string
+	// Args are the arguments of the instruction: the elements of its JSON array in the exec
+	// form, or else its words. Quoted words are kept whole, along with their quotes.
+	Args []string
+	// JSON is true if the arguments are written as a JSON array, in the exec form.
+	JSON bool
+	// Original is the instruction as written, with its continuation lines joined.
+	Original string
+	// Line is the (1-indexed) line the instruction starts on.
+	Line int
+}
+
+// Stage is a build stage: a FROM instruction and the instructions that follow it.
+type Stage struct {
+	// Name is the name the stage is given with "FROM <image> AS <name>", or empty.
+	Name string
+	// Image is the image the stage is built from, which may be the name of an earlier stage.
+	Image string
+	// Instructions are the instructions of the stage, starting with its FROM instruction.
+	Instructions []Instruction
+}
+
+// ParseError is returned when a Dockerfile cannot be parsed.
+type ParseError struct {
+	// Line is the (1-indexed) line of the instruction that cannot be parsed.
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Parse parses the Dockerfile read from r. Only the ARG instruction may come before the first
+// FROM.
+func Parse(r io.Reader) (*Dockerfile, error) {
+	d := new(Dockerfile)
+	escape := `\`
+	directives := true
+	var text strings.Builder
+	start := 0
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Text()
+		trimmed := strings.TrimSpace(raw)
+		if directives {
+			if m := directive.FindStringSubmatch(trimmed); m != nil {
+				if strings.ToLower(m[1]) == "escape" {
+					if m[2] != `\` && m[2] != "`" {
+						return nil, &ParseError{Line: line, Message: fmt.Sprintf("invalid escape character %q", m[2])}
+					}
+					escape = m[2]
+				}
+				continue
+			}
+			directives = false
+		}
+		// comments and blank lines are skipped, even between continuation lines
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if start == 0 {
+			start = line
+		}
+		if rest := strings.TrimRightFunc(raw, unicode.IsSpace); strings.HasSuffix(rest, escape) {
+			text.WriteString(strings.TrimSuffix(rest, escape))
+			continue
+		}
+		text.WriteString(raw)
+		if err := d.add(text.String(), start); err != nil {
+			return nil, err
+		}
+		text.Reset()
+		start = 0
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// the last instruction may end with a continuation
+	if start != 0 {
+		if err := d.add(text.String(), start); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// add parses the instruction written as text on the given line, and adds it to the Dockerfile.
+func (d *Dockerfile) add(text string, line int) error {
+	i, err := parseInstruction(text, line)
+	if err != nil {
+		return err
+	}
+	d.Instructions = append(d.Instructions, i)
+
+	if i.Command == "FROM" {
+		s := Stage{Image: i.Args[0]}
+		switch {
+		case len(i.Args) == 3 && strings.EqualFold(i.Args[1], "AS"):
+			s.Name = i.Args[2]
+		case len(i.Args) != 1:
+			return &ParseError{Line: line, Message: "FROM takes an image, optionally followed by AS <name>"}
+		}
+		d.Stages = append(d.Stages, s)
+	} else if len(d.Stages) == 0 && i.Command != "ARG" {
+		return &ParseError{Line: line, Message: fmt.Sprintf("%s comes before the first FROM", i.Command)}
+	}
+	if len(d.Stages) > 0 {
+		s := &d.Stages[len(d.Stages)-1]
+		s.Instructions = append(s.Instructions, i)
+	}
+	return nil
+}
+
+func parseInstruction(text string, line int) (Instruction, error) {
+	i := Instruction{Original: strings.TrimSpace(text), Line: line}
+	rest := i.Original
+	end := strings.IndexFunc(rest, unicode.IsSpace)
+	if end < 0 {
+		end = len(rest)
+	}
+	i.Command = strings.ToUpper(rest[:end])
+	rest = strings.TrimSpace(rest[end:])
+	if !commands[i.Command] {
+		return i, &ParseError{Line: line, Message: fmt.Sprintf("unknown instruction %s", i.Command)}
+	}
+
+	if flagCommands[i.Command] {
+		for strings.HasPrefix(rest, "--") {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			i.Flags = append(i.Flags, rest[:end])
+			rest = strings.TrimSpace(rest[end:])
+		}
+	}
+	if strings.HasPrefix(rest, "[") {
+		var args []string
+		if err := json.Unmarshal([]byte(rest), &args); err == nil {
+			i.Args, i.JSON = args, true
+		}
+	}
+	if !i.JSON {
+		i.Args = words(rest)
+	}
+	if len(i.Args) == 0 {
+		return i, &ParseError{Line: line, Message: fmt.Sprintf("%s requires at least one argument", i.Command)}
+	}
+	return i, nil
+}
+
+// words splits s into words separated by white space, keeping quoted words whole.
+func words(s string) []string {
+	var (
+		words []string
+		word  strings.Builder
+		quote rune
+		in    bool
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			if in {
+				words = append(words, word.String())
+				word.Reset()
+				in = false
+			}
+			continue
+		}
+		word.WriteRune(r)
+		in = true
+	}
+	if in {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// Vars returns the variables set by an ENV, ARG or LABEL instruction, in order, with the quotes
+// around their values removed. ARG instructions without a default value set their variable to
+// an empty value.
+func (i Instruction) Vars() [][2]string {
+	var vars [][2]string
+	switch i.Command {
+	case "ENV", "ARG", "LABEL":
+	default:
+		return nil
+	}
+	// the legacy form sets a single variable: "ENV <key> <value>"
+	if i.Command == "ENV" && !strings.Contains(i.Args[0], "=") {
+		return [][2]string{{i.Args[0], unquote(strings.Join(i.Args[1:], " "))}}
+	}
+	for _, arg := range i.Args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		vars = append(vars, [2]string{unquote(kv[0]), unquote(kv[1])})
+	}
+	return vars
+}
+
+// unquote removes the quotes around s, if any.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDockerfile = `# escape=\
+ARG VERSION=1.10
+
+# build the binary
+FROM golang:${VERSION} AS build
+COPY --from=deps --chown=app /go/pkg /go/pkg
+RUN go build \
+    # the binary is static
+    -o /app .
+
+FROM alpine:3.7
+ENV PORT=8080 NAME="hello world"
+env LEGACY some value
+EXPOSE 8080/tcp
+CMD ["/app", "--port", "8080"]
+`
+
+func TestParse(t *testing.T) {
+	d, err := Parse(strings.NewReader(testDockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Instructions) != 9 {
+		t.Fatalf("expected 9 instructions, got %d: %v", len(d.Instructions), d.Instructions)
+	}
+	if len(d.Stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(d.Stages))
+	}
+	if s := d.Stages[0]; s.Name != "build" || s.Image != "golang:${VERSION}" || len(s.Instructions) != 3 {
+		t.Errorf("unexpected first stage %+v", s)
+	}
+	if s := d.Stages[1]; s.Name != "" || s.Image != "alpine:3.7" || len(s.Instructions) != 5 {
+		t.Errorf("unexpected final stage %+v", s)
+	}
+
+	copyInstr := d.Instructions[2]
+	if want := []string{"--from=deps", "--chown=app"}; !reflect.DeepEqual(copyInstr.Flags, want) {
+		t.Errorf("expected flags %v, got %v", want, copyInstr.Flags)
+	}
+	run := d.Instructions[3]
+	if run.Line != 7 || run.Original != "RUN go build     -o /app ." {
+		t.Errorf("expected the continuation lines to be joined, got line %d: %q", run.Line, run.Original)
+	}
+	if from := d.Instructions[4]; from.Line != 11 {
+		t.Errorf("expected the second FROM on line 11, got %d", from.Line)
+	}
+	cmd := d.Instructions[8]
+	if want := []string{"/app", "--port", "8080"}; !cmd.JSON || !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("expected the exec form %v, got %v", want, cmd.Args)
+	}
+
+	if want := [][2]string{{"PORT", "8080"}, {"NAME", "hello world"}}; !reflect.DeepEqual(d.Instructions[5].Vars(), want) {
+		t.Errorf("expected variables %v, got %v", want, d.Instructions[5].Vars())
+	}
+	if want := [][2]string{{"LEGACY", "some value"}}; !reflect.DeepEqual(d.Instructions[6].Vars(), want) {
+		t.Errorf("expected variables %v, got %v", want, d.Instructions[6].Vars())
+	}
+}
+
+func TestParseEscapeDirective(t *testing.T) {
+	d, err := Parse(strings.NewReader("# escape=`\nFROM microsoft/nanoserver\nRUN dir c:\\ `\n    && echo done\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := d.Instructions[1]; run.Original != "RUN dir c:\\     && echo done" {
+		t.Errorf("expected the backtick to continue the line, got %q", run.Original)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]int{
+		"FROM alpine\nBUILD .\n":         2,
+		"RUN make\nFROM alpine\n":        1,
+		"FROM alpine\nEXPOSE\n":          2,
+		"FROM alpine AS\n":               1,
+		"# escape=|\nFROM alpine\n":      1,
+		"FROM alpine\n\nCOPY --from=a\n": 3,
+	}
+	for dockerfile, line := range tests {
+		_, err := Parse(strings.NewReader(dockerfile))
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q: expected a parse error, got %v", dockerfile, err)
+			continue
+		}
+		if parseErr.Line != line {
+			t.Errorf("%q: expected an error on line %d, got %v", dockerfile, line, err)
+		}
+	}
+}
@@ -2,32 +2,93 @@ package pack
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
-// CreateFrom scaffolds a directory with the src pack.
-func CreateFrom(dest, src string) error {
+// CreateFrom scaffolds a directory with the src pack, rendering its templates with values. Files
+// that already exist are left untouched.
+func CreateFrom(dest, src string, values TemplateValues) error {
 	// first do some validation that we are copying from a valid pack directory
 	pack, err := FromDir(src)
 	if err != nil {
-		return fmt.Errorf("could not load pack: %s\nTry running:\n\t$ draft pack-repo update", err)
+		return fmt.Errorf("could not load pack: %s\nTry running:\n\t$ generator-controller pack-repo update", err)
 	}
-	return pack.SaveDir(dest)
+	if err := pack.Render(values); err != nil {
+		return err
+	}
+	_, err = pack.Save(dest, SaveOptions{Policy: Skip})
+	return err
 }
 
 // Find loops through each pack repo in packsDir to find pack with given name
+//
+// The name is a pack reference (see ParseReference): if it is qualified with a repository,
+// only that repository is searched, and if it is qualified with a version, only packs whose
+// metadata declares that version, or that are in a repository at that version, are returned.
+//
+// The packs of the repository named repo.BuiltinName are only returned if no other repository
+// has a matching pack. The bundled packs are read through repo.WithBuiltin.
 func Find(packsDir, name string) ([]string, error) {
+	return FindFS(repo.WithBuiltin(vfs.OS, packsDir), packsDir, name)
+}
+
+// FindFS is like Find, but finds the packs in fsys.
+func FindFS(fsys vfs.FS, packsDir, name string) ([]string, error) {
+	ref, err := ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
 	packs := []string{}
-	for _, r := range repo.FindRepositories(packsDir) {
-		pack, err := r.Pack(name)
+	var fallback []string
+	for _, r := range repo.FindRepositoriesFS(fsys, packsDir) {
+		if ref.Repository != "" && ref.Repository != r.Name {
+			continue
+		}
+		pack, err := r.Pack(ref.Name)
 		if err != nil && err != repo.ErrPackNotFoundInRepo {
 			return packs, err
 		}
-		if pack != "" {
-			packs = append(packs, pack)
+		if pack == "" {
+			continue
+		}
+		if ref.Version != "" {
+			metadata, err := LoadMetadataFS(fsys, pack)
+			if err != nil {
+				return packs, err
+			}
+			if !ref.MatchesVersion(metadata.Version) && !ref.MatchesVersion(r.Version) {
+				continue
+			}
 		}
+		if r.Name == repo.BuiltinName {
+			fallback = append(fallback, pack)
+			continue
+		}
+		packs = append(packs, pack)
 	}
 
+	if len(packs) == 0 {
+		packs = append(packs, fallback...)
+	}
 	return packs, nil
 }
+
+// Select chooses between packs with the same name returned by Find, by returning the one in
+// the repository that comes first in precedence. It returns false if none of the packs is in
+// a repository listed in precedence.
+func Select(packsDir string, packs, precedence []string) (string, bool) {
+	for _, repoName := range precedence {
+		for _, pack := range packs {
+			// packs are found at <packsDir>/<repository>/packs/<name>
+			repoDir := filepath.Dir(filepath.Dir(pack))
+			rel, err := filepath.Rel(packsDir, repoDir)
+			if err == nil && filepath.ToSlash(rel) == repoName {
+				return pack, true
+			}
+		}
+	}
+	return "", false
+}
@@ -4,7 +4,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"testing/fstest"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
 func TestCreateFrom(t *testing.T) {
@@ -14,7 +19,7 @@ func TestCreateFrom(t *testing.T) {
 	}
 	defer os.RemoveAll(tdir)
 
-	if err := CreateFrom(tdir, filepath.Join("testdata", "pack-python")); err != nil {
+	if err := CreateFrom(tdir, filepath.Join("testdata", "pack-python"), TemplateValues{}); err != nil {
 		t.Errorf("expected err to be nil, got %v", err)
 	}
 
@@ -32,7 +37,109 @@ func TestCreateFrom(t *testing.T) {
 		}
 	}
 
-	if err := CreateFrom(tdir, filepath.Join("testdata", "pack-does-not-exist")); err == nil {
+	if err := CreateFrom(tdir, filepath.Join("testdata", "pack-does-not-exist"), TemplateValues{}); err == nil {
 		t.Error("expected err to be non-nil with an invalid source pack")
 	}
 }
+
+func TestCreateFromRendersTemplates(t *testing.T) {
+	src, err := ioutil.TempDir("", "pack-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	if err := ioutil.WriteFile(filepath.Join(src, "package.json.tmpl"), []byte(`{"name": "{{ .Name }}"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest, err := ioutil.TempDir("", "app-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	if err := CreateFrom(dest, src, TemplateValues{Name: "users"}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dest, "package.json")); err != nil || string(b) != `{"name": "users"}` {
+		t.Errorf("expected package.json to be rendered, got %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "package.json.tmpl")); !os.IsNotExist(err) {
+		t.Errorf("expected the template not to be copied, got %v", err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	packsRoot := filepath.Join("repo", "testdata", "packs")
+	repo1 := filepath.Join(packsRoot, "github.com", "testOrg1", "testRepo1", "packs", "testpack1")
+	repo2 := filepath.Join(packsRoot, "github.com", "testOrg1", "testRepo2", "packs", "testpack1")
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"testpack1", []string{repo1, repo2}},
+		{"github.com/testOrg1/testRepo2/testpack1", []string{repo2}},
+		{"testpack1@v0.1.0", []string{repo1}},
+		{"github.com/testOrg1/testRepo1/testpack1@0.2.0", []string{}},
+		{"github.com/testOrg1/missing/testpack1", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := Find(packsRoot, tt.name)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := Find(packsRoot, "testpack1@"); err == nil {
+		t.Error("expected an error for an invalid pack reference")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	packsRoot := filepath.Join("repo", "testdata", "packs")
+	found, err := Find(packsRoot, "testpack1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := Select(packsRoot, found, []string{"github.com/testOrg1/other", "github.com/testOrg1/testRepo2", "github.com/testOrg1/testRepo1"})
+	if !ok || got != found[1] {
+		t.Errorf("expected %s to be selected, got %q", found[1], got)
+	}
+	if _, ok := Select(packsRoot, found, []string{"github.com/testOrg1/other"}); ok {
+		t.Error("expected no pack to be selected when no repository takes precedence")
+	}
+}
+
+func TestFindBuiltin(t *testing.T) {
+	repo.Builtin = fstest.MapFS{
+		"testpack1/Dockerfile": {Data: []byte("FROM alpine\n")},
+		"builtin/Dockerfile":   {Data: []byte("FROM alpine\nEXPOSE 3000\n")},
+	}
+	defer func() { repo.Builtin = nil }()
+
+	packsRoot := filepath.Join("repo", "testdata", "packs")
+	// the bundled packs have the lowest precedence
+	got, err := Find(packsRoot, "testpack1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("expected the installed packs only, got %v", got)
+	}
+
+	got, err = Find(packsRoot, "builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(packsRoot, repo.BuiltinName, repo.PackDirName, "builtin")
+	if !reflect.DeepEqual(got, []string{want}) {
+		t.Fatalf("expected the bundled pack %s, got %v", want, got)
+	}
+	port, err := ExposedPortFS(repo.WithBuiltin(vfs.OS, packsRoot), got[0])
+	if err != nil || port != 3000 {
+		t.Errorf("expected the bundled pack to expose port 3000, got %d, %v", port, err)
+	}
+}
@@ -0,0 +1,231 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// defaultRuleScore is the score of detection rules that do not declare one.
+const defaultRuleScore = 0.5
+
+// maxDetectFiles is the maximum number of files Detect inspects in a directory.
+const maxDetectFiles = 10000
+
+// errEnoughFiles stops walking a directory once maxDetectFiles files were found.
+var errEnoughFiles = errors.New("enough files to detect the pack")
+
+// DetectRule is a rule used to detect that a directory holds an app the pack is made for,
+// declared in the pack's pack.toml as
+//
+//	[[detect]]
+//	pattern = "package.json"
+//	score = 0.9
+type DetectRule struct {
+	// Pattern is matched with path.Match against the slash-separated paths of the files in the
+	// directory, relative to it. Patterns without a slash are matched against the files' names
+	// instead, in any subdirectory.
+	Pattern string `toml:"pattern"`
+	// Contains is, if set, text that a matching file must contain.
+	Contains string `toml:"contains"`
+	// Score is the confidence, between 0 and 1, that a directory with a matching file holds an
+	// app the pack is made for. It defaults to 0.5.
+	Score float64 `toml:"score"`
+}
+
+// DefaultDetectRules are the detection rules of packs that do not declare their own, by pack name.
+var DefaultDetectRules = map[string][]DetectRule{
+	"clojure": {{Pattern: "project.clj", Score: 0.9}, {Pattern: "*.clj", Score: 0.5}},
+	"dotnet":  {{Pattern: "*.csproj", Score: 0.9}, {Pattern: "*.cs", Score: 0.5}},
+	"go":      {{Pattern: "go.mod", Score: 0.9}, {Pattern: "Gopkg.toml", Score: 0.8}, {Pattern: "*.go", Score: 0.5}},
+	"maven":   {{Pattern: "pom.xml", Score: 0.9}, {Pattern: "*.java", Score: 0.3}},
+	"nodejs":  {{Pattern: "package.json", Score: 0.9}, {Pattern: "*.js", Score: 0.3}},
+	"php":     {{Pattern: "composer.json", Score: 0.9}, {Pattern: "*.php", Score: 0.5}},
+	"python":  {{Pattern: "requirements.txt", Score: 0.9}, {Pattern: "setup.py", Score: 0.8}, {Pattern: "Pipfile", Score: 0.8}, {Pattern: "*.py", Score: 0.5}},
+	"ruby":    {{Pattern: "Gemfile", Score: 0.9}, {Pattern: "*.rb", Score: 0.5}},
+	"rust":    {{Pattern: "Cargo.toml", Score: 0.9}, {Pattern: "*.rs", Score: 0.5}},
+	"swift":   {{Pattern: "Package.swift", Score: 0.9}, {Pattern: "*.swift", Score: 0.5}},
+}
+
+// Detection is a pack detected as matching a directory.
+type Detection struct {
+	// Repository is the name of the repository the pack is in.
+	Repository string
+	// Name is the name of the pack.
+	Name string
+	// Dir is the directory of the pack.
+	Dir string
+	// Confidence is how confident the detection is, between 0 and 1.
+	Confidence float64
+	// Matched are the patterns of the rules that matched.
+	Matched []string
+}
+
+// Reference returns the fully qualified reference to the detected pack.
+func (d Detection) Reference() string {
+	return Reference{Repository: d.Repository, Name: d.Name}.String()
+}
+
+// Detect returns the packs in packsDir that match the files in dir, from the most to the least
+// confident. Packs that are as confident come in the order of their repositories in precedence,
+// as Select chooses between them, then in the order of the repositories that are not listed, so
+// the bundled packs come last.
+//
+// Each pack is matched using the detection rules in its metadata, or else its
+// DefaultDetectRules. The confidence of a pack combines the scores of its matching rules, so
+// that each matching rule makes the detection more confident: a pack whose rules with scores
+// 0.9 and 0.5 both match has a confidence of 1-(1-0.9)*(1-0.5) = 0.95.
+func Detect(packsDir, dir string, precedence []string) ([]Detection, error) {
+	return DetectFS(repo.WithBuiltin(vfs.OS, packsDir), packsDir, dir, precedence)
+}
+
+// DetectFS is like Detect, but reads the packs and the files in dir from fsys.
+func DetectFS(fsys vfs.FS, packsDir, dir string, precedence []string) ([]Detection, error) {
+	files, err := detectFiles(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var detections []Detection
+	for _, r := range repo.FindRepositoriesFS(fsys, packsDir) {
+		all, err := r.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, repoPack := range all {
+			name := path.Base(repoPack)
+			packDir, err := r.Pack(name)
+			if err != nil {
+				return nil, err
+			}
+			metadata, err := LoadMetadataFS(fsys, packDir)
+			if err != nil {
+				return nil, err
+			}
+			rules := metadata.Detect
+			if len(rules) == 0 {
+				rules = DefaultDetectRules[name]
+			}
+			d := Detection{Repository: r.Name, Name: name, Dir: packDir}
+			miss := 1.0
+			for _, rule := range rules {
+				matched, err := rule.matches(fsys, dir, files)
+				if err != nil {
+					return nil, err
+				}
+				if matched {
+					miss *= 1 - rule.score()
+					d.Matched = append(d.Matched, rule.Pattern)
+				}
+			}
+			if d.Confidence = 1 - miss; d.Confidence > 0 {
+				detections = append(detections, d)
+			}
+		}
+	}
+	rank := func(d Detection) int {
+		for i, name := range precedence {
+			if name == d.Repository {
+				return i
+			}
+		}
+		return len(precedence)
+	}
+	sort.SliceStable(detections, func(i, j int) bool {
+		if detections[i].Confidence != detections[j].Confidence {
+			return detections[i].Confidence > detections[j].Confidence
+		}
+		return rank(detections[i]) < rank(detections[j])
+	})
+	return detections, nil
+}
+
+func (r DetectRule) score() float64 {
+	if r.Score == 0 {
+		return defaultRuleScore
+	}
+	return r.Score
+}
+
+// validate checks that the rule's pattern and score are valid.
+func (r DetectRule) validate() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("detection rule has no pattern")
+	}
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid detection pattern %q", r.Pattern)
+	}
+	if r.Score < 0 || r.Score > 1 {
+		return fmt.Errorf("detection rule %q has a score of %v, which is not between 0 and 1", r.Pattern, r.Score)
+	}
+	return nil
+}
+
+// matches reports whether one of files, relative to dir in fsys, matches the rule.
+func (r DetectRule) matches(fsys vfs.FS, dir string, files []string) (bool, error) {
+	for _, f := range files {
+		name := f
+		if !strings.Contains(r.Pattern, "/") {
+			name = path.Base(f)
+		}
+		if matched, _ := path.Match(r.Pattern, name); !matched {
+			continue
+		}
+		if r.Contains == "" {
+			return true, nil
+		}
+		b, err := fsys.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return false, err
+		}
+		if bytes.Contains(b, []byte(r.Contains)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// detectFiles returns the slash-separated paths of the files in dir, relative to it, skipping
+// hidden files and the directories dependencies and build output are usually kept in.
+func detectFiles(fsys vfs.FS, dir string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case "node_modules", "vendor", "target", "bin", "obj":
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if len(files) >= maxDetectFiles {
+			return errEnoughFiles
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err == errEnoughFiles {
+		err = nil
+	}
+	return files, err
+}
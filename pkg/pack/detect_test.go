@@ -0,0 +1,97 @@
+package pack
+
+import (
+	"math"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+func TestDetect(t *testing.T) {
+	packsDir := filepath.Join("testdata", "detect", "packs")
+	tests := []struct {
+		app  string
+		want []Detection
+	}{
+		{
+			app: "app-go",
+			want: []Detection{
+				{Repository: "github.com/test/repo", Name: "go", Confidence: 0.95, Matched: []string{"go.mod", "*.go"}},
+			},
+		},
+		{
+			// the custom pack declares its own rule, and node_modules is not inspected
+			app: "app-node",
+			want: []Detection{
+				{Repository: "github.com/test/repo", Name: "custom", Confidence: 0.95, Matched: []string{"package.json"}},
+				{Repository: "github.com/test/repo", Name: "nodejs", Confidence: 0.9, Matched: []string{"package.json"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Detect(packsDir, filepath.Join("testdata", "detect", tt.app), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %d packs to be detected, got %v", tt.app, len(tt.want), got)
+			continue
+		}
+		for i, want := range tt.want {
+			d := got[i]
+			if d.Reference() != want.Repository+"/"+want.Name || math.Abs(d.Confidence-want.Confidence) > 1e-9 || len(d.Matched) != len(want.Matched) {
+				t.Errorf("%s: expected %s with confidence %v matching %v, got %s with confidence %v matching %v",
+					tt.app, want.Name, want.Confidence, want.Matched, d.Reference(), d.Confidence, d.Matched)
+			}
+		}
+	}
+
+	got, err := Detect(packsDir, filepath.Join("testdata", "pack-python"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no pack to be detected, got %v", got)
+	}
+}
+
+func TestDetectPrecedence(t *testing.T) {
+	m := vfs.NewMemFS()
+	for _, name := range []string{
+		"packs/a.com/first/repo/packs/nodejs/index.js",
+		"packs/b.com/second/repo/packs/nodejs/index.js",
+		"app/package.json",
+	} {
+		if err := m.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		precedence []string
+		want       []string
+	}{
+		{nil, []string{"a.com/first/repo/nodejs", "b.com/second/repo/nodejs"}},
+		{[]string{"b.com/second/repo"}, []string{"b.com/second/repo/nodejs", "a.com/first/repo/nodejs"}},
+		{[]string{"a.com/other/repo", "b.com/second/repo", "a.com/first/repo"}, []string{"b.com/second/repo/nodejs", "a.com/first/repo/nodejs"}},
+	}
+	for _, tt := range tests {
+		detections, err := DetectFS(m, "packs", "app", tt.precedence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range detections {
+			got = append(got, d.Reference())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("with precedence %v: expected %v, got %v", tt.precedence, tt.want, got)
+		}
+	}
+}
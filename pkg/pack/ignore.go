@@ -0,0 +1,168 @@
+package pack
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// IgnoreFileName is the name of the file listing the files of a pack that are not installed.
+const IgnoreFileName = ".packignore"
+
+// DefaultIgnore are the patterns of the files every pack leaves out: the files describing the
+// pack itself, its chart and version control data. A pack can include them again with a
+// negated pattern.
+var DefaultIgnore = []string{
+	"/README.md",
+	"/" + MetadataFileName,
+	"/" + IgnoreFileName,
+	"/charts/",
+	".git/",
+}
+
+// Ignore is a list of gitignore-style patterns excluding files from a pack.
+//
+// Patterns are matched against slash-separated paths relative to the pack, with path.Match and
+// "**" matching any number of directories. A pattern holding a slash other than a trailing one
+// is matched from the root of the pack, otherwise against the name of the file at any depth. A
+// trailing slash only matches directories, and a leading "!" includes the files matched by an
+// earlier pattern again. Blank lines and lines starting with "#" are ignored.
+//
+// The last pattern matching a path decides whether it is excluded. A directory that is excluded
+// is excluded along with everything it contains.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	// segments are the slash-separated parts of the pattern, starting with "**" if the pattern is
+	// not anchored to the root of the pack.
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ParseIgnore parses gitignore-style patterns.
+func ParseIgnore(patterns []string) (*Ignore, error) {
+	ignore := new(Ignore)
+	if err := ignore.add(patterns); err != nil {
+		return nil, err
+	}
+	return ignore, nil
+}
+
+// LoadIgnore loads the patterns excluding files from the pack in dir in fsys: DefaultIgnore,
+// then the ones listed in its metadata, then the ones in its IgnoreFileName if there is one.
+func LoadIgnore(fsys vfs.FS, dir string, m *Metadata) (*Ignore, error) {
+	ignore, err := ParseIgnore(DefaultIgnore)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		if err := ignore.add(m.Ignore); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", filepath.Join(dir, MetadataFileName), err)
+		}
+	}
+
+	path := filepath.Join(dir, IgnoreFileName)
+	f, err := fsys.Open(path)
+	if os.IsNotExist(err) {
+		return ignore, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if err := ignore.add(lines); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return ignore, nil
+}
+
+func (i *Ignore) add(patterns []string) error {
+	for _, pattern := range patterns {
+		pattern = strings.TrimRight(pattern, " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		var rule ignoreRule
+		p := pattern
+		if strings.HasPrefix(p, "!") {
+			rule.negate = true
+			p = p[1:]
+		} else if strings.HasPrefix(p, `\`) {
+			// an escaped leading "!" or "#"
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			rule.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		if strings.Trim(p, "/") == "" {
+			return fmt.Errorf("invalid ignore pattern %q", pattern)
+		}
+		if !strings.Contains(p, "/") {
+			p = "**/" + p
+		}
+		p = strings.TrimPrefix(p, "/")
+		rule.segments = strings.Split(p, "/")
+		for _, segment := range rule.segments {
+			if _, err := pathpkg.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid ignore pattern %q", pattern)
+			}
+		}
+		i.rules = append(i.rules, rule)
+	}
+	return nil
+}
+
+// Match reports whether the file at relPath, relative to the pack, is excluded. It does not
+// check whether one of the directories holding it is.
+func (i *Ignore) Match(relPath string, isDir bool) bool {
+	name := strings.Split(filepath.ToSlash(relPath), "/")
+	ignored := false
+	for _, rule := range i.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.segments, name) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchSegments matches the segments of a path against the segments of a pattern, where "**"
+// matches any number of segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := pathpkg.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,66 @@
+package pack
+
+import (
+	"testing"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	ignore, err := ParseIgnore(append(append([]string{}, DefaultIgnore...),
+		"# editor files",
+		"*.swp",
+		"",
+		"node_modules/",
+		"/build",
+		"docs/*.md",
+		"src/**/generated",
+		"!src/keep.swp",
+		`\!important`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"README.md", false, true},
+		{"docs/README.md", false, true},
+		{"src/README.md", false, false},
+		{"pack.toml", false, true},
+		{".packignore", false, true},
+		{"charts", true, true},
+		{"charts", false, false},
+		{"src/charts", true, false},
+		{".git", true, true},
+		{"src/.git", true, true},
+		{".swp", false, true},
+		{"src/main.go.swp", false, true},
+		{"src/keep.swp", false, false},
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false},
+		{"build", true, true},
+		{"build", false, true},
+		{"src/build", true, false},
+		{"docs/guide/intro.md", false, false},
+		{"src/generated", false, true},
+		{"src/a/b/generated", true, true},
+		{"generated", false, false},
+		{"!important", false, true},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := ignore.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v): expected %v, got %v", tt.path, tt.isDir, tt.want, got)
+		}
+	}
+}
+
+func TestParseIgnoreErrors(t *testing.T) {
+	for _, pattern := range []string{"[", "src/[a-", "/", "!"} {
+		if _, err := ParseIgnore([]string{pattern}); err == nil {
+			t.Errorf("expected an error parsing %q", pattern)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/dockerfile"
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// Finding is a problem Lint found in a pack.
+type Finding struct {
+	// File is the path of the file the problem is in, relative to the pack.
+	File string
+	// Line is the (1-indexed) line the problem is on, or 0 if it concerns the whole file.
+	Line int
+	// Message describes the problem.
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%s: %s", f.File, f.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", f.File, f.Line, f.Message)
+}
+
+// Lint checks that the pack in dir follows the conventions the generator relies on, and returns
+// the problems it found, sorted by file and line:
+//
+// - the pack has a valid pack.toml and a .dockerignore;
+// - the final stage of its Dockerfile exposes the port of the pack and sets the PORT
+// environment variable to it, the port being the one from the pack's metadata, or else
+// DefaultPort;
+// - the final stage has no ONBUILD instruction, which would only run when another image is
+// built from the image;
+// - every base image is pinned to a tag other than "latest", or to a digest.
+//
+// It returns an error if the pack cannot be read.
+func Lint(dir string) ([]Finding, error) {
+	return LintFS(vfs.OS, dir)
+}
+
+// LintFS is like Lint, but checks the pack in dir in fsys.
+func LintFS(fsys vfs.FS, dir string) ([]Finding, error) {
+	var findings []Finding
+	b, err := fsys.ReadFile(filepath.Join(dir, MetadataFileName))
+	if os.IsNotExist(err) {
+		findings = append(findings, Finding{File: MetadataFileName, Message: "missing: the pack has no metadata"})
+	} else if err != nil {
+		return nil, err
+	} else if _, err := parseMetadata(b); err != nil {
+		// the pack cannot be loaded until its metadata is fixed
+		return append(findings, Finding{File: MetadataFileName, Message: err.Error()}), nil
+	}
+
+	p, err := FromFS(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := p.Files[".dockerignore"]; !ok || !f.IsRegular() {
+		findings = append(findings, Finding{File: ".dockerignore", Message: "missing: the whole controller directory is sent to Docker when building its image"})
+	}
+	port := p.Metadata.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	dockerfileFindings, err := lintDockerfile(p, port)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, dockerfileFindings...)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// lintDockerfile checks the Dockerfile of p, which should make the image listen on port.
+func lintDockerfile(p *Pack, port int) ([]Finding, error) {
+	const name = "Dockerfile"
+	f, ok := p.Files[name]
+	if !ok || !f.IsRegular() {
+		return []Finding{{File: name, Message: "missing"}}, nil
+	}
+	b, err := f.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	d, err := dockerfile.Parse(bytes.NewReader(b))
+	if parseErr, ok := err.(*dockerfile.ParseError); ok {
+		return []Finding{{File: name, Line: parseErr.Line, Message: parseErr.Message}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(d.Stages) == 0 {
+		return []Finding{{File: name, Message: "no FROM instruction"}}, nil
+	}
+
+	var findings []Finding
+	stages := make(map[string]int)
+	for i, s := range d.Stages {
+		if msg := checkBaseImage(s.Image, stages); msg != "" {
+			findings = append(findings, Finding{File: name, Line: s.Instructions[0].Line, Message: msg})
+		}
+		if s.Name != "" {
+			stages[strings.ToLower(s.Name)] = i
+		}
+	}
+
+	final := d.Stages[len(d.Stages)-1]
+	for _, i := range final.Instructions {
+		if i.Command == "ONBUILD" {
+			findings = append(findings, Finding{File: name, Line: i.Line, Message: fmt.Sprintf("%q in the final stage only runs when another image is built from this one", i.Original)})
+		}
+	}
+
+	// the final stage inherits the environment of the stages it is built from
+	chain := []dockerfile.Stage{final}
+	for current := len(d.Stages) - 1; ; {
+		i, ok := stages[strings.ToLower(d.Stages[current].Image)]
+		if !ok || i >= current {
+			break
+		}
+		current = i
+		chain = append([]dockerfile.Stage{d.Stages[i]}, chain...)
+	}
+	env := make(map[string]string)
+	var envPort, expose *dockerfile.Instruction
+	exposed := false
+	for _, s := range chain {
+		for _, i := range s.Instructions {
+			i := i
+			switch i.Command {
+			case "ENV":
+				for _, kv := range i.Vars() {
+					env[kv[0]] = expand(kv[1], env)
+					if kv[0] == "PORT" {
+						envPort = &i
+					}
+				}
+			case "ARG":
+				// build arguments do not override the environment
+				for _, kv := range i.Vars() {
+					if _, ok := env[kv[0]]; !ok {
+						env[kv[0]] = expand(kv[1], env)
+					}
+				}
+			case "EXPOSE":
+				if expose == nil {
+					expose = &i
+				}
+				for _, arg := range i.Args {
+					if parsePort(strings.SplitN(expand(arg, env), "/", 2)[0]) == port {
+						exposed = true
+					}
+				}
+			}
+		}
+	}
+
+	switch {
+	case expose == nil:
+		findings = append(findings, Finding{File: name, Message: fmt.Sprintf("the final stage does not EXPOSE the port of the pack, %d", port)})
+	case !exposed:
+		findings = append(findings, Finding{File: name, Line: expose.Line, Message: fmt.Sprintf("%q does not expose the port of the pack, %d", expose.Original, port)})
+	}
+	switch {
+	case envPort == nil:
+		findings = append(findings, Finding{File: name, Message: fmt.Sprintf("the final stage does not set ENV PORT to the port of the pack, %d", port)})
+	case parsePort(env["PORT"]) != port:
+		findings = append(findings, Finding{File: name, Line: envPort.Line, Message: fmt.Sprintf("%q does not set PORT to the port of the pack, %d", envPort.Original, port)})
+	}
+	return findings, nil
+}
+
+// checkBaseImage returns what is wrong with the base image of a stage, or an empty string.
+// Images named after an earlier stage, the empty "scratch" image and images given through a
+// variable are not checked.
+func checkBaseImage(image string, stages map[string]int) string {
+	if _, ok := stages[strings.ToLower(image)]; ok || image == "scratch" || strings.Contains(image, "$") {
+		return ""
+	}
+	if strings.Contains(image, "@") {
+		return ""
+	}
+	// the tag follows the last colon, unless that colon separates a registry from its port
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return fmt.Sprintf("base image %s is not pinned to a tag or digest", image)
+	}
+	if name[i+1:] == "latest" {
+		return fmt.Sprintf("base image %s is not pinned: the latest tag changes over time", image)
+	}
+	return ""
+}
+
+// expand replaces the references to the variables in env in s, written as $name or ${name}.
+func expand(s string, env map[string]string) string {
+	return os.Expand(s, func(name string) string {
+		if v, ok := env[name]; ok {
+			return v
+		}
+		return "$" + name
+	})
+}
@@ -0,0 +1,123 @@
+package pack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+func TestLint(t *testing.T) {
+	const (
+		metadata     = "name = \"test\"\nversion = \"1.0.0\"\n"
+		dockerignore = ".git\n"
+	)
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "conventional",
+			files: map[string]string{
+				MetadataFileName: metadata,
+				".dockerignore":  dockerignore,
+				"Dockerfile":     "FROM golang:1.10 AS build\nRUN go build -o /app\n\nFROM alpine:3.7\nENV PORT 8080\nEXPOSE $PORT\nCOPY --from=build /app /app\n",
+			},
+		},
+		{
+			name: "port inherited from an earlier stage",
+			files: map[string]string{
+				MetadataFileName: metadata + "port = 3000\n",
+				".dockerignore":  dockerignore,
+				"Dockerfile":     "FROM node:8 AS base\nENV PORT=3000\n\nFROM base\nEXPOSE 3000/tcp\n",
+			},
+		},
+		{
+			name: "swift",
+			files: map[string]string{
+				MetadataFileName: metadata,
+				"Dockerfile":     "FROM swift\n\nWORKDIR /src\nONBUILD COPY . /src\nONBUILD RUN swift build -c release\n\nENV PORT 8080\nEXPOSE 8080\n",
+			},
+			want: []string{
+				".dockerignore: missing: the whole controller directory is sent to Docker when building its image",
+				"Dockerfile:1: base image swift is not pinned to a tag or digest",
+				`Dockerfile:4: "ONBUILD COPY . /src" in the final stage only runs when another image is built from this one`,
+				`Dockerfile:5: "ONBUILD RUN swift build -c release" in the final stage only runs when another image is built from this one`,
+			},
+		},
+		{
+			name: "wrong port",
+			files: map[string]string{
+				MetadataFileName: metadata,
+				".dockerignore":  dockerignore,
+				"Dockerfile":     "FROM python:latest\nENV PORT=80\nEXPOSE 80\n",
+			},
+			want: []string{
+				"Dockerfile:1: base image python:latest is not pinned: the latest tag changes over time",
+				`Dockerfile:2: "ENV PORT=80" does not set PORT to the port of the pack, 8080`,
+				`Dockerfile:3: "EXPOSE 80" does not expose the port of the pack, 8080`,
+			},
+		},
+		{
+			name: "port only set in a build stage",
+			files: map[string]string{
+				".dockerignore": dockerignore,
+				"Dockerfile":    "FROM registry:5000/golang@sha256:abc AS build\nENV PORT 8080\nEXPOSE 8080\nFROM scratch\nCOPY --from=build /app /app\n",
+			},
+			want: []string{
+				"Dockerfile: the final stage does not EXPOSE the port of the pack, 8080",
+				"Dockerfile: the final stage does not set ENV PORT to the port of the pack, 8080",
+				"pack.toml: missing: the pack has no metadata",
+			},
+		},
+		{
+			name: "invalid Dockerfile",
+			files: map[string]string{
+				MetadataFileName: metadata,
+				".dockerignore":  dockerignore,
+				"Dockerfile":     "FROM alpine:3.7\nBUILD .\n",
+			},
+			want: []string{"Dockerfile:2: unknown instruction BUILD"},
+		},
+		{
+			name: "invalid metadata",
+			files: map[string]string{
+				MetadataFileName: "port = 70000\n",
+				"Dockerfile":     "FROM alpine:3.7\n",
+			},
+			want: []string{"pack.toml: invalid port 70000"},
+		},
+		{
+			name: "no Dockerfile",
+			files: map[string]string{
+				MetadataFileName: metadata,
+				".dockerignore":  dockerignore,
+			},
+			want: []string{"Dockerfile: missing"},
+		},
+	}
+	for _, tt := range tests {
+		m := vfs.NewMemFS()
+		if err := m.Mkdir("pack", 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range tt.files {
+			if err := m.WriteFile("pack/"+name, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		findings, err := LintFS(m, "pack")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, f := range findings {
+			got = append(got, f.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected findings\n%q\ngot\n%q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package pack
 
 import (
+	"path"
+
 	"github.com/bacongobbler/kubed-generator-controller/pkg/pack/repo"
 )
 
@@ -21,3 +23,47 @@ func List(packsDir, repoName string) ([]string, error) {
 	}
 	return packs, nil
 }
+
+// Info describes a pack found in a repository.
+type Info struct {
+	// Repository is the name of the repository the pack was found in.
+	Repository string `json:"repository" yaml:"repository"`
+	// Name is the name of the pack in the repository.
+	Name string `json:"name" yaml:"name"`
+	// Description is the description from the pack's metadata, if any.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Version is the version from the pack's metadata, if any.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// ListInfo is like List, but describes each pack with the repository it was found in and its metadata.
+func ListInfo(packsDir, repoName string) ([]Info, error) {
+	var infos []Info
+	for _, r := range repo.FindRepositories(packsDir) {
+		if repoName != "" && repoName != r.Name {
+			continue
+		}
+		all, err := r.List()
+		if err != nil {
+			return infos, err
+		}
+		for _, repoPack := range all {
+			name := path.Base(repoPack)
+			dir, err := r.Pack(name)
+			if err != nil {
+				return infos, err
+			}
+			metadata, err := LoadMetadataFS(r.FS(), dir)
+			if err != nil {
+				return infos, err
+			}
+			infos = append(infos, Info{
+				Repository:  r.Name,
+				Name:        name,
+				Description: metadata.Description,
+				Version:     metadata.Version,
+			})
+		}
+	}
+	return infos, nil
+}
@@ -43,3 +43,26 @@ func TestListRepo(t *testing.T) {
 		t.Fatalf("want: %v\ngot: %v\n", want, got)
 	}
 }
+
+func TestListInfo(t *testing.T) {
+	packsRoot := filepath.Join("repo", "testdata", "packs")
+	want := []Info{
+		{Repository: "github.com/testOrg1/testRepo1", Name: "testpack1", Description: "The first test pack", Version: "0.1.0"},
+		{Repository: "github.com/testOrg1/testRepo1", Name: "testpack2"},
+	}
+	got, err := ListInfo(packsRoot, "github.com/testOrg1/testRepo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want: %v\ngot: %v\n", want, got)
+	}
+
+	all, err := ListInfo(packsRoot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Errorf("expected 4 packs across all repositories, got %v", all)
+	}
+}
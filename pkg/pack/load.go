@@ -1,11 +1,14 @@
 package pack
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
 // FromDir takes a string name, tries to resolve it to a file or directory, and then loads it.
@@ -13,76 +16,137 @@ import (
 // This is the preferred way to load a pack. It will discover the pack encoding
 // and hand off to the appropriate pack reader.
 func FromDir(dir string) (*Pack, error) {
-	pack := new(Pack)
-	pack.Files = make(map[string]io.ReadCloser)
-
 	topdir, err := filepath.Abs(dir)
 	if err != nil {
 		return nil, err
 	}
+	return FromFS(vfs.OS, topdir)
+}
 
-	files, err := ioutil.ReadDir(topdir)
-	if err != nil {
-		return nil, fmt.Errorf("error reading %s: %s", topdir, err)
-	}
+// FromFS is like FromDir, but loads the pack in dir in fsys.
+func FromFS(fsys vfs.FS, dir string) (*Pack, error) {
+	pack := new(Pack)
 
-	// load all files in pack directory
-	for _, fInfo := range files {
-		if !fInfo.IsDir() {
-			f, err := os.Open(filepath.Join(topdir, fInfo.Name()))
-			if err != nil {
-				return nil, err
-			}
-			if fInfo.Name() != "README.md" {
-				pack.Files[fInfo.Name()] = f
-			}
-		} else {
-			if fInfo.Name() != "charts" {
-				packFiles, err := extractFiles(filepath.Join(topdir, fInfo.Name()), "")
-				if err != nil {
-					return nil, err
-				}
-				for k, v := range packFiles {
-					pack.Files[k] = v
-				}
-			}
-		}
+	if _, err := fsys.Stat(dir); err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", dir, err)
 	}
 
-	return pack, nil
-}
-
-func extractFiles(dir, base string) (map[string]io.ReadCloser, error) {
-	baseDir := filepath.Join(base, filepath.Base(dir))
-	packFiles := make(map[string]io.ReadCloser)
+	var err error
+	if pack.Metadata, err = LoadMetadataFS(fsys, dir); err != nil {
+		return nil, err
+	}
 
-	absDir, err := filepath.Abs(dir)
+	ignore, err := LoadIgnore(fsys, dir, pack.Metadata)
 	if err != nil {
 		return nil, err
 	}
 
-	files, err := ioutil.ReadDir(absDir)
+	// load all files in pack directory, except for the excluded ones
+	pack.Files, err = extractFiles(fsys, dir, func(relPath string, fi os.FileInfo) bool {
+		return ignore.Match(relPath, fi.IsDir())
+	})
 	if err != nil {
-		return packFiles, fmt.Errorf("error reading %s: %s", dir, err)
+		return nil, err
 	}
+	return pack, nil
+}
 
-	for _, fInfo := range files {
-		if !fInfo.IsDir() {
-			fPath := filepath.Join(dir, fInfo.Name())
-			f, err := os.Open(fPath)
-			if err != nil {
-				return nil, err
+// extractFiles lists the files, directories and symlinks under dir in fsys, keyed by their path
+// relative to dir. Entries for which skip returns true are left out, along with everything they
+// contain. Symlinks are not followed, and must resolve inside dir, going through the other
+// symlinks that are listed. Regular files are only opened when they are read.
+func extractFiles(fsys vfs.FS, dir string, skip func(relPath string, fi os.FileInfo) bool) (map[string]*File, error) {
+	packFiles := make(map[string]*File)
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if skip != nil && skip(relPath, fi) {
+			if fi.IsDir() {
+				return filepath.SkipDir
 			}
-			packFiles[filepath.Join(baseDir, fInfo.Name())] = f
-		} else {
-			nestedPackFiles, err := extractFiles(filepath.Join(dir, fInfo.Name()), baseDir)
+			return nil
+		}
+
+		mode := fi.Mode() & (os.ModeDir | os.ModeSymlink | os.ModePerm)
+		switch {
+		case fi.IsDir():
+			packFiles[relPath] = &File{Mode: mode}
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := fsys.ReadLink(path)
 			if err != nil {
-				return nil, err
-			}
-			for k, v := range nestedPackFiles {
-				packFiles[k] = v
+				return err
 			}
+			packFiles[relPath] = &File{Mode: mode, Target: target}
+		case fi.Mode().IsRegular():
+			packFiles[relPath] = FSFile(fsys, mode, path)
+		default:
+			return fmt.Errorf("%s is not a regular file, a directory or a symlink", relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", dir, err)
+	}
+	// a symlink may go through another one, so they are checked once they are all listed
+	for relPath, f := range packFiles {
+		if !f.IsSymlink() {
+			continue
+		}
+		if err := resolveLink(packFiles, relPath); err != nil {
+			return nil, fmt.Errorf("error reading %s: symlink %s to %s: %v", dir, relPath, f.Target, err)
 		}
 	}
 	return packFiles, nil
 }
+
+var errLinkOutside = errors.New("points outside of the pack")
+
+// resolveLink checks that the symlink at relPath in files resolves to a path inside the pack,
+// following the symlinks of the pack it goes through, as the operating system would once the
+// pack is saved. The target does not need to exist.
+func resolveLink(files map[string]*File, relPath string) error {
+	p := filepath.Dir(relPath)
+	rest := []string{filepath.Base(relPath)}
+	links := 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			// p is a directory of the pack, as every symlink on the way was followed
+			if p == "." {
+				return errLinkOutside
+			}
+			p = filepath.Dir(p)
+			continue
+		}
+		next := filepath.Join(p, elem)
+		f, ok := files[next]
+		if !ok || !f.IsSymlink() {
+			p = next
+			continue
+		}
+		if links++; links > vfs.MaxSymlinks {
+			return vfs.ErrTooManyLinks
+		}
+		if filepath.IsAbs(f.Target) {
+			return errLinkOutside
+		}
+		rest = append(strings.Split(filepath.FromSlash(f.Target), string(filepath.Separator)), rest...)
+	}
+	return nil
+}
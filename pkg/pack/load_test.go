@@ -4,7 +4,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
 const (
@@ -24,22 +28,22 @@ func TestFromDir(t *testing.T) {
 		t.Fatalf("could not load python pack: %v", err)
 	}
 
-	defer func() {
-		for _, f := range pack.Files {
-			f.Close()
-		}
-	}()
-
 	if _, ok := pack.Files["README.md"]; ok {
 		t.Errorf("expected README.md to not have been loaded")
 	}
+	if _, ok := pack.Files[MetadataFileName]; ok {
+		t.Errorf("expected %s to not have been loaded", MetadataFileName)
+	}
+	if pack.Metadata.Name != "python" {
+		t.Errorf("expected the pack metadata to have been loaded, got %+v", pack.Metadata)
+	}
 	// check that the Dockerfile was loaded
 	dockerfile, ok := pack.Files[dockerfileName]
 	if !ok {
 		t.Error("expected Dockerfile to have been loaded")
 	}
 
-	dockerfileContents, err := ioutil.ReadAll(dockerfile)
+	dockerfileContents, err := dockerfile.ReadAll()
 	if err != nil {
 		t.Errorf("expected Dockerfile to be readable, got %v", err)
 	}
@@ -48,9 +52,17 @@ func TestFromDir(t *testing.T) {
 		t.Errorf("expected Dockerfile == expected file contents, got '%v'", dockerfileContents)
 	}
 
-	_, ok = pack.Files[filepath.Join("scripts", "some-script.sh")]
+	script, ok := pack.Files[filepath.Join("scripts", "some-script.sh")]
 	if !ok {
 		t.Errorf("Expected scripts/some-script.sh to have been loaded but wasn't")
+	} else if script.Mode&0111 == 0 {
+		t.Errorf("expected scripts/some-script.sh to keep its executable mode, got %v", script.Mode)
+	}
+	if scripts, ok := pack.Files["scripts"]; !ok || !scripts.IsDir() {
+		t.Errorf("expected the scripts directory to have been loaded, got %+v", scripts)
+	}
+	if _, ok := pack.Files["charts"]; ok {
+		t.Errorf("expected the charts directory to not have been loaded")
 	}
 
 	if _, err := FromDir("dir-does-not-exist"); err == nil {
@@ -110,12 +122,200 @@ func TestFromDir(t *testing.T) {
 
 func TestExtractFiles(t *testing.T) {
 
-	packFiles, err := extractFiles(filepath.Join("testdata", "DirWithNestedDirs"), "")
+	packFiles, err := extractFiles(vfs.OS, filepath.Join("testdata", "DirWithNestedDirs"), nil)
 	if err != nil {
 		t.Fatalf("Did not expect err but got err: %v", err)
 	}
-	if len(packFiles) != 4 {
-		t.Errorf("Expected 4 files to be extracted but got %v", len(packFiles))
+	var files, dirs int
+	for _, f := range packFiles {
+		if f.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	if files != 4 {
+		t.Errorf("Expected 4 files to be extracted but got %v", files)
+	}
+	if dirs != 3 {
+		t.Errorf("Expected 3 directories to be extracted but got %v", dirs)
+	}
+
+}
+
+func TestExtractFilesSymlinksAndEmptyDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "draft-pack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../run.sh", filepath.Join(dir, "bin", "run")); err != nil {
+		t.Fatal(err)
+	}
+
+	packFiles, err := extractFiles(vfs.OS, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty, ok := packFiles["empty"]; !ok || !empty.IsDir() {
+		t.Errorf("expected the empty directory to be extracted, got %+v", empty)
+	}
+	if run, ok := packFiles[filepath.Join("bin", "run")]; !ok || !run.IsSymlink() || run.Target != "../run.sh" {
+		t.Errorf("expected bin/run to be extracted as a symlink to ../run.sh, got %+v", run)
+	}
+	if script := packFiles["run.sh"]; script == nil || script.Mode != 0755 {
+		t.Errorf("expected run.sh to be extracted with mode 0755, got %+v", script)
+	}
+	// each symlink stays inside the pack as text, but bin/escape resolves to the parent of the pack
+	// through bin/up
+	if err := os.Symlink("..", filepath.Join(dir, "bin", "up")); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"../../outside", "/etc/passwd", "up/..", "escape"} {
+		link := filepath.Join(dir, "bin", "escape")
+		os.Remove(link)
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := extractFiles(vfs.OS, dir, nil); err == nil {
+			t.Errorf("expected a symlink to %s to be rejected", target)
+		}
+	}
+}
+
+func TestFromDirIgnore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "draft-pack-test")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
+	files := map[string]string{
+		MetadataFileName:                "name = \"ignored\"\nignore = [\"*.log\"]\n",
+		IgnoreFileName:                  "# local development files\nnode_modules/\n.*.swp\n!README.md\n",
+		"README.md":                     "# ignored\n",
+		"Dockerfile":                    "FROM scratch\n",
+		"debug.log":                     "",
+		"src/.index.js.swp":             "",
+		"src/index.js":                  "",
+		"src/node_modules/dep/index.js": "",
+		"src/charts/values.yaml":        "",
+		"charts/values.yaml":            "",
+		".git/HEAD":                     "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := FromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for relPath := range p.Files {
+		got = append(got, filepath.ToSlash(relPath))
+	}
+	sort.Strings(got)
+	want := []string{"Dockerfile", "README.md", "src", "src/charts", "src/charts/values.yaml", "src/index.js"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected files %v, got %v", want, got)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, IgnoreFileName), []byte("src/[\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromDir(dir); err == nil {
+		t.Errorf("expected an error loading a pack with an invalid %s", IgnoreFileName)
+	}
+}
+
+// openDescriptors returns the number of file descriptors open in the test process.
+func openDescriptors(t *testing.T) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot count open file descriptors: %v", err)
+	}
+	return len(fds)
+}
+
+func TestFromDirAndSaveDoNotLeakDescriptors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "draft-pack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// an existing file the pack leaves untouched
+	if err := ioutil.WriteFile(filepath.Join(dir, dockerfileName), []byte("FROM draft"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := openDescriptors(t)
+	for i := 0; i < 3; i++ {
+		p, err := FromDir(filepath.Join("testdata", "pack-python"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := openDescriptors(t); got != before {
+			t.Errorf("expected loading a pack to leave %d descriptors open, got %d", before, got)
+		}
+		if err := p.SaveDir(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := openDescriptors(t); got != before {
+		t.Errorf("expected %d descriptors to be open after saving the pack, got %d", before, got)
+	}
+}
+
+func TestFromFSAndSaveFS(t *testing.T) {
+	m := vfs.NewMemFS()
+	files := map[string]string{
+		filepath.Join("src", MetadataFileName): "ignore = [\"*.md\"]\n",
+		filepath.Join("src", dockerfileName):   expectedDockerfile,
+		filepath.Join("src", "NOTES.md"):       "notes\n",
+	}
+	for name, content := range files {
+		if err := m.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Symlink(dockerfileName, filepath.Join("src", "Containerfile")); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := FromFS(m, "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Files) != 2 {
+		t.Errorf("expected the Dockerfile and its symlink to be loaded, got %v", p.Files)
+	}
+	report, err := p.SaveFS(m, "dest", SaveOptions{Policy: Skip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 2 {
+		t.Errorf("expected 2 files to be created, got %v", report.Created)
+	}
+	if b, err := m.ReadFile(filepath.Join("dest", "Containerfile")); err != nil || string(b) != expectedDockerfile {
+		t.Errorf("expected dest/Containerfile to resolve to the Dockerfile, got %q, %v", b, err)
+	}
 }
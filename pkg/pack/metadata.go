@@ -0,0 +1,93 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// MetadataFileName is the name of the file describing a pack.
+const MetadataFileName = "pack.toml"
+
+// Metadata describes a pack. It is loaded from the pack's pack.toml.
+type Metadata struct {
+	// Name is the name of the pack.
+	Name string `toml:"name"`
+	// Description is a short description of the pack.
+	Description string `toml:"description"`
+	// Version is the version of the pack.
+	Version string `toml:"version"`
+	// Language is the programming language of the scaffolded application.
+	Language string `toml:"language"`
+	// Port is the port the scaffolded application listens on by default.
+	Port int `toml:"port"`
+	// HealthCheckPath is the HTTP path the scaffolded application answers health checks on.
+	HealthCheckPath string `toml:"health-check-path"`
+	// RequiredTools are the tools needed to build the scaffolded application locally.
+	RequiredTools []string `toml:"required-tools"`
+	// Templates are the patterns, matched with path.Match against slash-separated paths relative
+	// to the pack, of files to render as templates in addition to the ones ending in ".tmpl".
+	Templates []string `toml:"templates"`
+	// Variables are the variables the pack's templates accept, by name.
+	Variables map[string]Variable `toml:"variables"`
+	// Ignore are gitignore-style patterns of files left out of the pack, in addition to
+	// DefaultIgnore and the ones listed in the pack's .packignore.
+	Ignore []string `toml:"ignore"`
+	// Detect are the rules used to detect that a directory holds an app the pack is made for.
+	// Packs that declare none use their DefaultDetectRules.
+	Detect []DetectRule `toml:"detect"`
+}
+
+// LoadMetadata loads the metadata of the pack in dir. A pack without a pack.toml has empty metadata.
+func LoadMetadata(dir string) (*Metadata, error) {
+	return LoadMetadataFS(vfs.OS, dir)
+}
+
+// LoadMetadataFS is like LoadMetadata, but loads the metadata of the pack in dir in fsys.
+func LoadMetadataFS(fsys vfs.FS, dir string) (*Metadata, error) {
+	path := filepath.Join(dir, MetadataFileName)
+	b, err := fsys.ReadFile(path)
+	if os.IsNotExist(err) {
+		return new(Metadata), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", path, err)
+	}
+	m, err := parseMetadata(b)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// parseMetadata parses and validates the content of a pack.toml.
+func parseMetadata(b []byte) (*Metadata, error) {
+	m := new(Metadata)
+	if _, err := toml.Decode(string(b), m); err != nil {
+		return nil, err
+	}
+	if m.Port < 0 || m.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", m.Port)
+	}
+	for _, rule := range m.Detect {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateVariables(m.Variables); err != nil {
+		return nil, err
+	}
+	for _, pattern := range m.Templates {
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid template pattern %q", pattern)
+		}
+	}
+	if _, err := ParseIgnore(m.Ignore); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,51 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMetadata(t *testing.T) {
+	m, err := LoadMetadata(filepath.Join("testdata", "pack-python"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Metadata{
+		Name:            "python",
+		Description:     "A Flask application",
+		Version:         "1.2.0",
+		Language:        "python",
+		Port:            80,
+		HealthCheckPath: "/healthz",
+		RequiredTools:   []string{"python", "pip"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("expected %+v, got %+v", want, m)
+	}
+
+	// a pack without a pack.toml has empty metadata
+	m, err = LoadMetadata(filepath.Join("testdata", "DirWithNestedDirs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, &Metadata{}) {
+		t.Errorf("expected empty metadata, got %+v", m)
+	}
+
+	dir, err := ioutil.TempDir("", "draft-pack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, invalid := range []string{"port = 70000\n", "name = \n", "ignore = [\"src/[\"]\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, MetadataFileName), []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadMetadata(dir); err == nil {
+			t.Errorf("expected an error loading %q", invalid)
+		}
+	}
+}
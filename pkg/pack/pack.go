@@ -1,39 +1,100 @@
 package pack
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"path/filepath"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
 // Pack defines a Draft Starter Pack.
 type Pack struct {
-	// Files are the files inside the Pack that will be installed.
-	Files map[string]io.ReadCloser
+	// Metadata describes the Pack.
+	Metadata *Metadata
+	// Files are the files, directories and symlinks inside the Pack that will be installed,
+	// keyed by their path relative to the root of the Pack.
+	Files map[string]*File
 }
 
-// SaveDir saves a pack as files in a directory.
-func (p *Pack) SaveDir(dest string) error {
-	for relPath, f := range p.Files {
-		path := filepath.Join(dest, relPath)
-		_, err := os.Stat(path)
-		if os.IsNotExist(err) {
-			baseDir := filepath.Dir(path)
-			if os.MkdirAll(baseDir, 0755) != nil {
-				return fmt.Errorf("Error creating directory %v: %v", baseDir, err)
-			}
-			newfile, err := os.Create(path)
-			if err != nil {
-				return err
-			}
-			defer newfile.Close()
-			defer f.Close()
-			io.Copy(newfile, f)
-		} else if err != nil {
-			return err
-		}
+// File is an entry of a Pack: a regular file, a directory or a symlink.
+//
+// The content of a regular file is only opened when it is read, and closed as soon as it has
+// been, so a Pack holds no open file descriptors.
+type File struct {
+	// Mode holds the type and permission bits of the entry.
+	Mode os.FileMode
+	// Target is the target of a symlink, relative to the directory holding it.
+	Target string
+	// open opens the content of a regular file. It is nil for directories and symlinks.
+	open func() (io.ReadCloser, error)
+}
+
+// NewFile returns a regular file whose content is opened with open when it is read.
+func NewFile(mode os.FileMode, open func() (io.ReadCloser, error)) *File {
+	return &File{Mode: mode.Perm(), open: open}
+}
+
+// BytesFile returns a regular file holding content.
+func BytesFile(mode os.FileMode, content []byte) *File {
+	return NewFile(mode, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+}
+
+// FSFile returns a regular file whose content is read from the file at path in fsys.
+func FSFile(fsys vfs.FS, mode os.FileMode, path string) *File {
+	return NewFile(mode, func() (io.ReadCloser, error) {
+		return fsys.Open(path)
+	})
+}
+
+// IsDir reports whether f is a directory.
+func (f *File) IsDir() bool {
+	return f.Mode.IsDir()
+}
+
+// IsSymlink reports whether f is a symlink.
+func (f *File) IsSymlink() bool {
+	return f.Mode&os.ModeSymlink != 0
+}
+
+// IsRegular reports whether f is a regular file.
+func (f *File) IsRegular() bool {
+	return f.Mode.IsRegular()
+}
+
+// Open opens the content of a regular file. The caller must close it.
+func (f *File) Open() (io.ReadCloser, error) {
+	if f.open == nil {
+		return nil, fmt.Errorf("cannot open the content of a %s", f.kind())
 	}
+	return f.open()
+}
+
+// ReadAll reads the whole content of a regular file, closing it before returning.
+func (f *File) ReadAll() ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// SaveDir saves a pack as files in a directory. Files that already exist are left untouched;
+// use Save to choose another policy and get a report of the files that were skipped.
+//
+// Deprecated: the pack's templates are saved as they are unless Render was called first. Use
+// CreateFrom, or Render and Save.
+func (p *Pack) SaveDir(dest string) error {
+	_, err := p.Save(dest, SaveOptions{Policy: Skip})
+	return err
+}
 
-	return nil
+// Save saves the pack as files in dest on disk, as SaveFS does.
+func (p *Pack) Save(dest string, opts SaveOptions) (*SaveReport, error) {
+	return p.SaveFS(vfs.OS, dest, opts)
 }
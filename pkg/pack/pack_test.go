@@ -2,11 +2,13 @@ package pack
 
 import (
 	"bytes"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
 const testDockerfile = `FROM nginx:latest
@@ -23,8 +25,8 @@ cleanup-task = "echo cleanup"
 
 func TestSaveDir(t *testing.T) {
 	p := &Pack{
-		Files: map[string]io.ReadCloser{
-			dockerfileName: ioutil.NopCloser(bytes.NewBufferString(testDockerfile)),
+		Files: map[string]*File{
+			dockerfileName: BytesFile(0644, []byte(testDockerfile)),
 		},
 	}
 	dir, err := ioutil.TempDir("", "draft-pack-test")
@@ -49,8 +51,8 @@ func TestSaveDir(t *testing.T) {
 
 func TestSaveDirDockerfileExistsInAppDir(t *testing.T) {
 	p := &Pack{
-		Files: map[string]io.ReadCloser{
-			dockerfileName: ioutil.NopCloser(bytes.NewBufferString(testDockerfile)),
+		Files: map[string]*File{
+			dockerfileName: BytesFile(0644, []byte(testDockerfile)),
 		},
 	}
 	dir, err := ioutil.TempDir("", "draft-pack-test")
@@ -78,3 +80,209 @@ func TestSaveDirDockerfileExistsInAppDir(t *testing.T) {
 		t.Errorf("expected '%s', got '%s'", string(expectedDockerfile), string(savedDockerfile))
 	}
 }
+
+func TestSavePolicies(t *testing.T) {
+	newPack := func() *Pack {
+		return &Pack{
+			Files: map[string]*File{
+				dockerfileName: BytesFile(0644, []byte(testDockerfile)),
+				"main.go":      BytesFile(0644, []byte("package main\n")),
+				"same.txt":     BytesFile(0644, []byte("same\n")),
+			},
+		}
+	}
+	tests := []struct {
+		policy     OverwritePolicy
+		prompt     PromptFunc
+		dockerfile string
+		report     SaveReport
+	}{
+		{
+			policy:     Skip,
+			dockerfile: "FROM draft",
+			report:     SaveReport{Created: []string{"main.go"}, Unchanged: []string{"same.txt"}, Skipped: []string{dockerfileName}},
+		},
+		{
+			policy:     Overwrite,
+			dockerfile: testDockerfile,
+			report:     SaveReport{Created: []string{"main.go"}, Unchanged: []string{"same.txt"}, Overwritten: []string{dockerfileName}},
+		},
+		{
+			policy:     Backup,
+			dockerfile: testDockerfile,
+			report:     SaveReport{Created: []string{"main.go"}, Unchanged: []string{"same.txt"}, Overwritten: []string{dockerfileName}, Backups: []string{dockerfileName + BackupSuffix}},
+		},
+		{
+			policy: MergePrompt,
+			prompt: func(path string, existing, incoming []byte) (OverwritePolicy, error) {
+				if string(existing) != "FROM draft" || string(incoming) != testDockerfile {
+					t.Errorf("unexpected prompt for %s: %q, %q", path, existing, incoming)
+				}
+				return Overwrite, nil
+			},
+			dockerfile: testDockerfile,
+			report:     SaveReport{Created: []string{"main.go"}, Unchanged: []string{"same.txt"}, Overwritten: []string{dockerfileName}},
+		},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "draft-pack-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, dockerfileName), []byte("FROM draft"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "same.txt"), []byte("same\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := newPack().Save(dir, SaveOptions{Policy: tt.policy, Prompt: tt.prompt})
+		if err != nil {
+			t.Errorf("%s: %v", tt.policy, err)
+			continue
+		}
+		for _, paths := range []*[]string{&report.Created, &report.Unchanged, &report.Skipped, &report.Overwritten, &report.Backups} {
+			for i, p := range *paths {
+				(*paths)[i], _ = filepath.Rel(dir, p)
+			}
+		}
+		if !reflect.DeepEqual(*report, tt.report) {
+			t.Errorf("%s: expected report %+v, got %+v", tt.policy, tt.report, *report)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, dockerfileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.dockerfile {
+			t.Errorf("%s: expected the Dockerfile to be %q, got %q", tt.policy, tt.dockerfile, b)
+		}
+		if tt.policy == Backup {
+			if b, err := ioutil.ReadFile(filepath.Join(dir, dockerfileName+BackupSuffix)); err != nil || string(b) != "FROM draft" {
+				t.Errorf("expected the Dockerfile to be backed up, got %q, %v", b, err)
+			}
+		}
+	}
+}
+
+func TestSaveModesAndSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "draft-pack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Symlink("elsewhere", filepath.Join(dir, "same-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "replaced-link"), []byte("run.sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Pack{
+		Files: map[string]*File{
+			"bin":           {Mode: os.ModeDir | 0700},
+			"bin/run.sh":    BytesFile(0755, []byte("#!/bin/sh\n")),
+			"bin/run":       {Mode: os.ModeSymlink | 0777, Target: "run.sh"},
+			"empty":         {Mode: os.ModeDir | 0755},
+			"same-link":     {Mode: os.ModeSymlink | 0777, Target: "elsewhere"},
+			"replaced-link": {Mode: os.ModeSymlink | 0777, Target: "run.sh"},
+		},
+	}
+	report, err := p.Save(dir, SaveOptions{Policy: Overwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SaveReport{
+		Created:     []string{filepath.Join(dir, "bin/run"), filepath.Join(dir, "bin/run.sh")},
+		Unchanged:   []string{filepath.Join(dir, "same-link")},
+		Overwritten: []string{filepath.Join(dir, "replaced-link")},
+	}
+	if !reflect.DeepEqual(*report, want) {
+		t.Errorf("expected report %+v, got %+v", want, *report)
+	}
+
+	for path, mode := range map[string]os.FileMode{
+		"bin":        os.ModeDir | 0700,
+		"bin/run.sh": 0755,
+		"empty":      os.ModeDir | 0755,
+	} {
+		fi, err := os.Lstat(filepath.Join(dir, path))
+		if err != nil {
+			t.Errorf("expected %s to be saved, got %v", path, err)
+		} else if got := fi.Mode() & (os.ModeType | os.ModePerm); got != mode {
+			t.Errorf("expected %s to be saved with mode %v, got %v", path, mode, got)
+		}
+	}
+	for path, target := range map[string]string{
+		"bin/run":       "run.sh",
+		"same-link":     "elsewhere",
+		"replaced-link": "run.sh",
+	} {
+		if got, err := os.Readlink(filepath.Join(dir, path)); err != nil || got != target {
+			t.Errorf("expected %s to be a symlink to %s, got %q, %v", path, target, got, err)
+		}
+	}
+}
+
+func TestSaveFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "draft-pack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, dockerfileName), []byte("FROM draft"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Pack{
+		Files: map[string]*File{
+			dockerfileName: BytesFile(0644, []byte(testDockerfile)),
+			"main.go":      BytesFile(0644, []byte("package main\n")),
+		},
+	}
+	_, err = p.Save(dir, SaveOptions{Policy: Fail})
+	if existsErr, ok := err.(*FileExistsError); !ok || len(existsErr.Paths) != 1 {
+		t.Fatalf("expected a *FileExistsError for the Dockerfile, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.go")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written, got %v", err)
+	}
+}
+
+func TestSaveBackupName(t *testing.T) {
+	m := vfs.NewMemFS()
+	for name, content := range map[string]string{dockerfileName: "FROM draft", dockerfileName + BackupSuffix: "FROM older"} {
+		if err := m.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first free name is taken by a file of the pack
+	p := &Pack{
+		Files: map[string]*File{
+			dockerfileName:                       BytesFile(0644, []byte(testDockerfile)),
+			dockerfileName + BackupSuffix + ".1": BytesFile(0644, []byte("backup\n")),
+		},
+	}
+	report, err := p.SaveFS(m, "/", SaveOptions{Policy: Backup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := "/" + dockerfileName + BackupSuffix + ".2"
+	if !reflect.DeepEqual(report.Backups, []string{backup}) {
+		t.Errorf("expected the Dockerfile to be backed up to %s, got %v", backup, report.Backups)
+	}
+	for name, want := range map[string]string{dockerfileName + BackupSuffix: "FROM older", backup: "FROM draft", dockerfileName: testDockerfile} {
+		if b, err := m.ReadFile(name); err != nil || string(b) != want {
+			t.Errorf("expected %s to hold %q, got %q, %v", name, want, b, err)
+		}
+	}
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	for _, p := range OverwritePolicies {
+		if got, err := ParseOverwritePolicy(string(p)); err != nil || got != p {
+			t.Errorf("expected %s to parse, got %q, %v", p, got, err)
+		}
+	}
+	if _, err := ParseOverwritePolicy("clobber"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
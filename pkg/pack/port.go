@@ -0,0 +1,72 @@
+package pack
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// DefaultPort is the port a controller listens on when neither the user nor the pack chose one.
+const DefaultPort = 8080
+
+// ExposedPort returns the port the Dockerfile of the pack in dir tells the application to listen
+// on, either through the PORT environment variable or an EXPOSE instruction. It returns 0 if the
+// pack does not have a Dockerfile or the Dockerfile declares neither.
+func ExposedPort(dir string) (int, error) {
+	return ExposedPortFS(vfs.OS, dir)
+}
+
+// ExposedPortFS is like ExposedPort, but reads the Dockerfile of the pack in dir in fsys.
+func ExposedPortFS(fsys vfs.FS, dir string) (int, error) {
+	f, err := fsys.Open(filepath.Join(dir, "Dockerfile"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var envPort, exposedPort int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "ENV":
+			if fields[1] == "PORT" && len(fields) > 2 {
+				envPort = parsePort(fields[2])
+			}
+			for _, field := range fields[1:] {
+				if strings.HasPrefix(field, "PORT=") {
+					envPort = parsePort(strings.Trim(strings.TrimPrefix(field, "PORT="), `"'`))
+				}
+			}
+		case "EXPOSE":
+			if exposedPort == 0 {
+				exposedPort = parsePort(strings.SplitN(fields[1], "/", 2)[0])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if envPort != 0 {
+		return envPort, nil
+	}
+	return exposedPort, nil
+}
+
+// parsePort parses a port number, returning 0 if s is not a valid port.
+func parsePort(s string) int {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,47 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExposedPort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "draft-pack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		dockerfile string
+		want       int
+	}{
+		{"FROM node:8\nENV PORT 3000\nEXPOSE 3000\n", 3000},
+		{"FROM node:8\nENV NODE_ENV=production PORT=\"4000\"\n", 4000},
+		{"FROM node:8\nexpose 5000/tcp 5001\n", 5000},
+		{"FROM node:8\nEXPOSE 80\nENV PORT 8081\n", 8081},
+		{"FROM node:8\nENV PORT $SOME_PORT\n", 0},
+		{"FROM node:8\n", 0},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(filepath.Join(dir, dockerfileName), []byte(tt.dockerfile), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ExposedPort(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("expected port %d for %q, got %d", tt.want, tt.dockerfile, got)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, dockerfileName)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ExposedPort(dir); err != nil || got != 0 {
+		t.Errorf("expected no port without a Dockerfile, got %d, %v", got, err)
+	}
+}
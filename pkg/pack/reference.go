@@ -0,0 +1,59 @@
+package pack
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Reference refers to a pack by name, optionally qualified with the repository it is in and
+// the version it must be at, in the form
+//
+// [<repository>/]<name>[@<version>]
+//
+// e.g. "nodejs", "github.com/org/repo/nodejs" or "github.com/org/repo/nodejs@v1.2.0".
+type Reference struct {
+	// Repository is the name of the repository the pack is in, or empty for any repository.
+	Repository string
+	// Name is the name of the pack.
+	Name string
+	// Version is the version the pack must be at, or empty for any version.
+	Version string
+}
+
+// ParseReference parses a pack reference.
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s, ref.Version = s[:i], s[i+1:]
+		if ref.Version == "" {
+			return Reference{}, fmt.Errorf("invalid pack reference %q: missing version after '@'", s+"@")
+		}
+	}
+	ref.Name = path.Base(s)
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		ref.Repository = s[:i]
+	}
+	if s == "" || ref.Name == "" || strings.HasSuffix(s, "/") || strings.HasPrefix(s, "/") {
+		return Reference{}, fmt.Errorf("invalid pack reference %q", s)
+	}
+	return ref, nil
+}
+
+// String returns the reference in the form it is parsed from.
+func (r Reference) String() string {
+	s := r.Name
+	if r.Repository != "" {
+		s = r.Repository + "/" + s
+	}
+	if r.Version != "" {
+		s += "@" + r.Version
+	}
+	return s
+}
+
+// MatchesVersion reports whether a pack at version v satisfies the reference. Versions are
+// compared ignoring a leading "v", so "v1.2.0" and "1.2.0" are the same version.
+func (r Reference) MatchesVersion(v string) bool {
+	return r.Version == "" || strings.TrimPrefix(r.Version, "v") == strings.TrimPrefix(v, "v")
+}
@@ -0,0 +1,48 @@
+package pack
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Reference
+	}{
+		{"nodejs", Reference{Name: "nodejs"}},
+		{"nodejs@1.0.0", Reference{Name: "nodejs", Version: "1.0.0"}},
+		{"github.com/org/repo/nodejs", Reference{Repository: "github.com/org/repo", Name: "nodejs"}},
+		{"github.com/org/repo/nodejs@v1.2.0", Reference{Repository: "github.com/org/repo", Name: "nodejs", Version: "v1.2.0"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseReference(tt.ref)
+		if err != nil {
+			t.Errorf("%s: %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.ref, tt.want, got)
+		}
+		if got.String() != tt.ref {
+			t.Errorf("expected %+v to format as %s, got %s", got, tt.ref, got.String())
+		}
+	}
+
+	for _, invalid := range []string{"", "nodejs@", "@1.0.0", "github.com/org/repo/", "/nodejs"} {
+		if _, err := ParseReference(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestMatchesVersion(t *testing.T) {
+	if !(Reference{Name: "nodejs"}).MatchesVersion("1.0.0") {
+		t.Error("expected a reference without a version to match any version")
+	}
+	if !(Reference{Name: "nodejs", Version: "v1.0.0"}).MatchesVersion("1.0.0") {
+		t.Error("expected v1.0.0 to match 1.0.0")
+	}
+	if (Reference{Name: "nodejs", Version: "1.0.0"}).MatchesVersion("1.1.0") {
+		t.Error("expected 1.0.0 not to match 1.1.0")
+	}
+}
@@ -0,0 +1,357 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// ErrUnverifiedArchive indicates that an archive was neither given a checksum nor a signature to
+// be verified with.
+var ErrUnverifiedArchive = errors.New("pack repo archives must be verified with a SHA-256 checksum or a signature")
+
+// MaxArchiveSize is the size, in bytes, of the largest archive AddArchive reads. Larger archives
+// are rejected before they are verified.
+var MaxArchiveSize int64 = 100 << 20
+
+// MaxUnpackedSize is the total size, in bytes, of the files an archive may unpack to, and
+// MaxArchiveEntries the number of entries it may hold. As a small archive can decompress to much
+// more, archives exceeding either are rejected while they are unpacked.
+var (
+	MaxUnpackedSize   int64 = 1 << 30
+	MaxArchiveEntries       = 10000
+)
+
+// httpClient downloads archives, giving up on servers that stop responding.
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Verification is how a pack repo archive is verified before it is unpacked. At least one of
+// SHA256 and Signature must be set; if both are, both must match.
+type Verification struct {
+	// SHA256 is the hex-encoded SHA-256 checksum of the archive.
+	SHA256 string
+	// Signature is a detached OpenPGP signature of the archive, armored or binary.
+	Signature []byte
+	// Keyring holds the OpenPGP public keys, armored or binary, that Signature may be made by.
+	Keyring []byte
+}
+
+// verify verifies the content of an archive.
+func (v Verification) verify(archive []byte) error {
+	if v.SHA256 == "" && v.Signature == nil {
+		return ErrUnverifiedArchive
+	}
+	if v.SHA256 != "" {
+		sum := sha256.Sum256(archive)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, v.SHA256) {
+			return fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", v.SHA256, got)
+		}
+	}
+	if v.Signature != nil {
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(v.Keyring))
+		if err != nil {
+			if keyring, err = openpgp.ReadKeyRing(bytes.NewReader(v.Keyring)); err != nil {
+				return fmt.Errorf("could not read keyring: %v", err)
+			}
+		}
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(archive), bytes.NewReader(v.Signature))
+		if err != nil {
+			_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(archive), bytes.NewReader(v.Signature))
+		}
+		if err != nil {
+			return fmt.Errorf("invalid signature: %v", err)
+		}
+	}
+	return nil
+}
+
+// IsArchive reports whether source is a gzipped tarball, given as a local path or a URL.
+func IsArchive(source string) bool {
+	return strings.HasSuffix(source, ".tar.gz") || strings.HasSuffix(source, ".tgz")
+}
+
+// AddArchive installs the repository in the gzipped tarball at source in home, under the name
+// returned by NameFromSource. The source is a local path or an HTTP(S) URL.
+//
+// The archive is verified before it is unpacked. It may hold the repository at its root or in
+// a single top-level directory, as in archives of git tags. Archives with entries outside of
+// the repository, such as absolute paths, paths containing ".." or paths going through a
+// symlink, and archives with symlinks resolving outside of the repository, are rejected. The
+// archive cannot be larger than MaxArchiveSize, nor unpack to more than MaxUnpackedSize or
+// MaxArchiveEntries. The version is recorded as given, as archives
+// have no version of their own.
+func AddArchive(home, source, version string, v Verification) (*Repository, error) {
+	name, err := NameFromSource(strings.TrimSuffix(strings.TrimSuffix(source, ".tar.gz"), ".tgz"))
+	if err != nil {
+		return nil, err
+	}
+	r := &Repository{
+		Name:    name,
+		Dir:     filepath.Join(home, filepath.FromSlash(name)),
+		Source:  source,
+		Version: version,
+	}
+	if _, err := os.Stat(r.Dir); err == nil {
+		return nil, ErrExists
+	}
+
+	archive, err := fetch(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.verify(archive); err != nil {
+		return nil, fmt.Errorf("could not verify %s: %v", source, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.Dir), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(r.Dir), ".unpack-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := unpack(bytes.NewReader(archive), tmp); err != nil {
+		return nil, fmt.Errorf("could not unpack %s: %v", source, err)
+	}
+	root, err := archiveRoot(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a pack repo: %v", source, err)
+	}
+	// the temporary directory is only accessible to its owner
+	if err := os.Chmod(root, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(root, r.Dir); err != nil {
+		return nil, err
+	}
+	if err := r.SaveMetadata(); err != nil {
+		os.RemoveAll(r.Dir)
+		return nil, err
+	}
+	return r, nil
+}
+
+// fetch returns the content of a local file or an HTTP(S) URL, which cannot be larger than
+// MaxArchiveSize.
+func fetch(source string) ([]byte, error) {
+	var r io.Reader
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(localPath(source))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		resp, err := httpClient.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("could not download %s: %s", source, resp.Status)
+		}
+		r = resp.Body
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, MaxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > MaxArchiveSize {
+		return nil, fmt.Errorf("%s is larger than the maximum archive size of %d bytes", source, MaxArchiveSize)
+	}
+	return b, nil
+}
+
+// unpack unpacks a gzipped tarball into dest, rejecting entries that would be written outside
+// of dest, either directly or through a symlink, and symlinks resolving outside of dest. It stops
+// at MaxArchiveEntries entries or MaxUnpackedSize bytes.
+func unpack(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	symlinks := make(map[string]string)
+	var entries int
+	var written int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if entries++; entries > MaxArchiveEntries {
+			return fmt.Errorf("the archive has more than the maximum of %d entries", MaxArchiveEntries)
+		}
+		name, err := entryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if link, err := firstSymlink(dest, name); err != nil {
+			return err
+		} else if link != "" {
+			return fmt.Errorf("entry %s is written through the symlink %s", hdr.Name, filepath.ToSlash(link))
+		}
+		target := filepath.Join(dest, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(f, io.LimitReader(tr, MaxUnpackedSize-written+1))
+			written += n
+			if err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			if written > MaxUnpackedSize {
+				return fmt.Errorf("the archive unpacks to more than the maximum of %d bytes", MaxUnpackedSize)
+			}
+		case tar.TypeSymlink:
+			linked := filepath.Join(filepath.Dir(name), filepath.FromSlash(hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || escapes(linked) {
+				return fmt.Errorf("symlink %s points outside of the archive: %s", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			symlinks[name] = hdr.Linkname
+		case tar.TypeXGlobalHeader:
+			// pax global headers, as written by git archive, hold no file
+		default:
+			return fmt.Errorf("unsupported entry %s of type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+
+	// a symlink may go through one that comes later in the archive, so they are checked once
+	// they all exist
+	for name, linkname := range symlinks {
+		inside, err := resolvesInside(dest, name, linkname)
+		if err != nil {
+			return err
+		}
+		if !inside {
+			return fmt.Errorf("symlink %s points outside of the archive: %s", filepath.ToSlash(name), linkname)
+		}
+	}
+	return nil
+}
+
+// firstSymlink returns the first of the relative path p and the directories holding it that is a
+// symlink in root, or an empty path if there is none.
+func firstSymlink(root, p string) (string, error) {
+	var rel string
+	for _, part := range strings.Split(p, string(filepath.Separator)) {
+		rel = filepath.Join(rel, part)
+		fi, err := os.Lstat(filepath.Join(root, rel))
+		if os.IsNotExist(err) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return rel, nil
+		}
+	}
+	return "", nil
+}
+
+// resolvesInside reports whether the symlink at the relative path rel in root, pointing to
+// target, resolves to a file inside root. The target must be relative and must not go through
+// another symlink, which would be resolved from a different directory; only its last element may
+// be one, as that symlink is checked on its own. The parts of the target that do not exist are
+// checked as text.
+func resolvesInside(root, rel, target string) (bool, error) {
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return false, nil
+	}
+	parts := strings.Split(filepath.FromSlash(target), string(filepath.Separator))
+	p := filepath.Dir(rel)
+	for i, part := range parts {
+		// joining ".." to p is only right because p was checked not to be a symlink
+		p = filepath.Join(p, part)
+		if escapes(p) {
+			return false, nil
+		}
+		if i == len(parts)-1 || p == "." {
+			continue
+		}
+		fi, err := os.Lstat(filepath.Join(root, p))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// entryPath returns the path of an archive entry relative to the directory it is unpacked in,
+// or an error if it would be written outside of it.
+func entryPath(name string) (string, error) {
+	p := filepath.FromSlash(name)
+	if filepath.IsAbs(p) || strings.HasPrefix(name, "/") || escapes(p) {
+		return "", fmt.Errorf("entry %s is outside of the archive", name)
+	}
+	return filepath.Clean(p), nil
+}
+
+// escapes reports whether the relative path p refers to a file outside of its root.
+func escapes(p string) bool {
+	p = filepath.Clean(p)
+	return p == ".." || strings.HasPrefix(p, ".."+string(os.PathSeparator))
+}
+
+// archiveRoot returns the root of the repository unpacked in dir: dir itself if it has a packs
+// directory, or else its only subdirectory if that has one.
+func archiveRoot(dir string) (string, error) {
+	if fi, err := os.Stat(filepath.Join(dir, PackDirName)); err == nil && fi.IsDir() {
+		return dir, nil
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		root := filepath.Join(dir, entries[0].Name())
+		if fi, err := os.Stat(filepath.Join(root, PackDirName)); err == nil && fi.IsDir() {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("it has no %s directory", PackDirName)
+}
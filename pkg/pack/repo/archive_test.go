@@ -0,0 +1,351 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+type tarEntry struct {
+	name, content, linkname string
+	typeflag                byte
+}
+
+// newArchive returns a gzipped tarball with the given entries.
+func newArchive(t *testing.T, entries ...tarEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: e.typeflag, Linkname: e.linkname}
+		if e.typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil && hdr.Size > 0 {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAddArchiveFromFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	home := filepath.Join(tmp, "packs")
+
+	// archives of git tags hold the repository in a single top-level directory
+	archive := newArchive(t,
+		tarEntry{name: "repo-1.0.0/", typeflag: tar.TypeDir},
+		tarEntry{name: "repo-1.0.0/packs/go/main.go", content: "package main\n"},
+		tarEntry{name: "repo-1.0.0/packs/go/link.go", linkname: "main.go", typeflag: tar.TypeSymlink},
+	)
+	source := filepath.Join(tmp, "kubed", "repo.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(source, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AddArchive(home, source, "", Verification{}); err == nil || err.Error() != "could not verify "+source+": "+ErrUnverifiedArchive.Error() {
+		t.Errorf("expected an unverified archive to be rejected, got %v", err)
+	}
+	if _, err := AddArchive(home, source, "", Verification{SHA256: sha256Hex([]byte("other"))}); err == nil {
+		t.Error("expected an archive with the wrong checksum to be rejected")
+	}
+
+	r, err := AddArchive(home, source, "1.0.0", Verification{SHA256: sha256Hex(archive)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := FindRepository(home, "local/kubed/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Dir != r.Dir || found.Source != source || found.Version != "1.0.0" {
+		t.Errorf("expected %s installed from %s at 1.0.0, got %+v", r.Dir, source, found)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(r.Dir, "packs", "go", "link.go"))
+	if err != nil || string(b) != "package main\n" {
+		t.Errorf("expected the go pack to be unpacked, got %q, %v", b, err)
+	}
+	if fi, err := os.Stat(r.Dir); err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("expected %s to have mode 0755, got %v, %v", r.Dir, fi, err)
+	}
+	if err := r.Update(""); err == nil {
+		t.Error("expected an error updating a pack repo installed from an archive")
+	}
+}
+
+func TestAddArchiveFromHTTPWithSignature(t *testing.T) {
+	archive := newArchive(t, tarEntry{name: "packs/go/main.go", content: "package main\n"})
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signature, keyring bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, entity, bytes.NewReader(archive), nil); err != nil {
+		t.Fatal(err)
+	}
+	w, err := armor.Encode(&keyring, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kubed/packs.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer ts.Close()
+
+	home, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	verification := Verification{Signature: signature.Bytes(), Keyring: keyring.Bytes()}
+	if _, err := AddArchive(home, ts.URL+"/kubed/missing.tar.gz", "", verification); err == nil {
+		t.Error("expected an error for a missing archive")
+	}
+
+	r, err := AddArchive(home, ts.URL+"/kubed/packs.tar.gz", "", verification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Pack("go"); err != nil {
+		t.Errorf("expected the go pack to be installed: %v", err)
+	}
+	if err := Remove(home, r.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature.Reset()
+	if err := openpgp.ArmoredDetachSign(&signature, other, bytes.NewReader(archive), nil); err != nil {
+		t.Fatal(err)
+	}
+	verification.Signature = signature.Bytes()
+	if _, err := AddArchive(home, ts.URL+"/kubed/packs.tar.gz", "", verification); err == nil {
+		t.Error("expected an archive signed by an unknown key to be rejected")
+	}
+}
+
+func TestAddArchiveTooLarge(t *testing.T) {
+	archive := newArchive(t, tarEntry{name: "packs/go/main.go", content: "package main\n"})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer ts.Close()
+	home, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	defer func(size int64) { MaxArchiveSize = size }(MaxArchiveSize)
+	MaxArchiveSize = int64(len(archive)) - 1
+	if _, err := AddArchive(home, ts.URL+"/kubed/packs.tar.gz", "", Verification{SHA256: sha256Hex(archive)}); err == nil || !strings.Contains(err.Error(), "maximum archive size") {
+		t.Errorf("expected an archive larger than MaxArchiveSize to be rejected, got %v", err)
+	}
+	MaxArchiveSize = int64(len(archive))
+	if _, err := AddArchive(home, ts.URL+"/kubed/packs.tar.gz", "", Verification{SHA256: sha256Hex(archive)}); err != nil {
+		t.Errorf("expected an archive of MaxArchiveSize to be installed, got %v", err)
+	}
+}
+
+func TestAddArchiveUnpackedTooLarge(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	home := filepath.Join(tmp, "packs")
+	add := func(name string, entries ...tarEntry) error {
+		archive := newArchive(t, entries...)
+		source := filepath.Join(tmp, "kubed", name+".tar.gz")
+		if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(source, archive, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := AddArchive(home, source, "", Verification{SHA256: sha256Hex(archive)})
+		return err
+	}
+
+	// compresses to far less than it unpacks to
+	zeros := strings.Repeat("\x00", 1<<20)
+	defer func(size int64) { MaxUnpackedSize = size }(MaxUnpackedSize)
+	MaxUnpackedSize = 1<<20 + 1
+	err = add("bomb",
+		tarEntry{name: "packs/go/a", content: zeros},
+		tarEntry{name: "packs/go/b", content: zeros},
+	)
+	if err == nil || !strings.Contains(err.Error(), "maximum of 1048577 bytes") {
+		t.Errorf("expected an archive unpacking to more than MaxUnpackedSize to be rejected, got %v", err)
+	}
+
+	defer func(n int) { MaxArchiveEntries = n }(MaxArchiveEntries)
+	MaxArchiveEntries = 2
+	err = add("many",
+		tarEntry{name: "packs/go/a", content: "a"},
+		tarEntry{name: "packs/go/b", content: "b"},
+		tarEntry{name: "packs/go/c", content: "c"},
+	)
+	if err == nil || !strings.Contains(err.Error(), "maximum of 2 entries") {
+		t.Errorf("expected an archive with more than MaxArchiveEntries to be rejected, got %v", err)
+	}
+	if err := add("few", tarEntry{name: "packs/go/a", content: "a"}, tarEntry{name: "packs/go/b", content: "b"}); err != nil {
+		t.Errorf("expected an archive with MaxArchiveEntries entries to be installed, got %v", err)
+	}
+
+}
+
+func TestAddArchiveLegacyRegularFiles(t *testing.T) {
+	// tar.Writer writes regular files as TypeReg, so the type of the entry is set afterwards
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	content := "package main\n"
+	if err := tw.WriteHeader(&tar.Header{Name: "packs/go/main.go", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	hdr := tarball.Bytes()[:512]
+	hdr[156] = tar.TypeRegA
+	copy(hdr[148:156], "        ")
+	var sum int64
+	for _, c := range hdr {
+		sum += int64(c)
+	}
+	copy(hdr[148:156], fmt.Sprintf("%06o\x00 ", sum))
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	if _, err := gz.Write(tarball.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	source := filepath.Join(tmp, "kubed", "legacy.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(source, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := AddArchive(filepath.Join(tmp, "packs"), source, "", Verification{SHA256: sha256Hex(archive.Bytes())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(r.Dir, "packs", "go", "main.go")); err != nil || string(b) != content {
+		t.Errorf("expected the legacy regular file to be unpacked, got %q, %v", b, err)
+	}
+}
+
+func TestAddArchiveRejectsPathTraversal(t *testing.T) {
+	tests := map[string][]tarEntry{
+		"parent directory": {{name: "packs/go/main.go", content: "package main\n"}, {name: "packs/../../evil", content: "evil"}},
+		"absolute path":    {{name: "packs/go/main.go", content: "package main\n"}, {name: "/tmp/evil", content: "evil"}},
+		"symlink":          {{name: "packs/go/main.go", content: "package main\n"}, {name: "packs/go/evil", linkname: "../../../evil", typeflag: tar.TypeSymlink}},
+		// each symlink stays inside the archive as text, but the file is written two directories
+		// above it
+		"symlink chain": {
+			{name: "a/b/s", linkname: "../..", typeflag: tar.TypeSymlink},
+			{name: "a/b/s/up", linkname: "../..", typeflag: tar.TypeSymlink},
+			{name: "a/b/s/up/evil", content: "evil"},
+		},
+		"symlink through a later symlink": {
+			{name: "packs/go/main.go", content: "package main\n"},
+			{name: "packs/t", linkname: "s/../..", typeflag: tar.TypeSymlink},
+			{name: "packs/s", linkname: "..", typeflag: tar.TypeSymlink},
+		},
+		"file over a symlink": {
+			{name: "packs/go/main.go", content: "package main\n"},
+			{name: "packs/go/link", linkname: "main.go", typeflag: tar.TypeSymlink},
+			{name: "packs/go/link", content: "evil"},
+		},
+	}
+	for name, entries := range tests {
+		tmp, err := ioutil.TempDir("", "pack-repo-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		archive := newArchive(t, entries...)
+		source := filepath.Join(tmp, "kubed", "repo.tgz")
+		os.MkdirAll(filepath.Dir(source), 0755)
+		if err := ioutil.WriteFile(source, archive, 0644); err != nil {
+			t.Fatal(err)
+		}
+		home := filepath.Join(tmp, "home", "packs")
+		if _, err := AddArchive(home, source, "", Verification{SHA256: sha256Hex(archive)}); err == nil {
+			t.Errorf("%s: expected the archive to be rejected", name)
+		}
+		filepath.Walk(tmp, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Name() == "evil" {
+				t.Errorf("%s: expected no file to be written outside of the pack repo, got %s", name, path)
+			}
+			return err
+		})
+		if repos := FindRepositories(home); len(repos) != 0 {
+			t.Errorf("%s: expected no pack repo to be installed, got %v", name, repos)
+		}
+	}
+}
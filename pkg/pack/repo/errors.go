@@ -11,6 +11,8 @@ var (
 	ErrHomeMissing = errors.New(`pack repo home does not exist`)
 	// ErrMissingSource indicates that information about the source of the pack repo was not found
 	ErrMissingSource = errors.New("cannot get information about pack repo source")
+	// ErrBuiltin indicates that the pack repo is the one bundled with the generator, which cannot be changed
+	ErrBuiltin = errors.New("pack repo is bundled with the generator and cannot be changed")
 	// ErrRepoDirty indicates that the pack repo was modified
 	ErrRepoDirty = errors.New("pack repo was modified")
 	//ErrVersionDoesNotExist indicates that the requested pack repo version does not exist
@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// IsDirty reports whether the files of the repository were modified since it was installed or
+// last checked out. It returns ErrMissingSource if the repository is not a git checkout.
+func (r *Repository) IsDirty() (bool, error) {
+	if _, err := os.Stat(filepath.Join(r.Dir, ".git")); err != nil {
+		if os.IsNotExist(err) {
+			return false, ErrMissingSource
+		}
+		return false, err
+	}
+	// the metadata file is written after the repository is checked out, so it is not tracked
+	out, err := r.git("status", "--porcelain", "--untracked-files=all", "--", ".", ":(exclude)"+MetadataFileName)
+	if err != nil {
+		return false, err
+	}
+	return out != "", nil
+}
+
+// Checkout checks out the given version of the repository, which is any git ref such as a tag
+// or a commit, and records it in the repository's metadata file.
+//
+// It returns ErrRepoDirty if the repository was modified, and ErrVersionDoesNotExist if the
+// version cannot be found.
+func (r *Repository) Checkout(version string) error {
+	dirty, err := r.IsDirty()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return ErrRepoDirty
+	}
+	return r.checkout(version)
+}
+
+// checkout checks out the given version of the repository and records it in the repository's
+// metadata file. Symbolic versions such as HEAD are recorded as the tag or commit they resolve
+// to. Versions starting with "-" are rejected, as git would read them as options.
+func (r *Repository) checkout(version string) error {
+	if strings.HasPrefix(version, "-") {
+		return fmt.Errorf("invalid version %q: versions cannot start with \"-\"", version)
+	}
+	if _, err := r.git("rev-parse", "--verify", "--quiet", version+"^{commit}"); err != nil {
+		return ErrVersionDoesNotExist
+	}
+	if _, err := r.git("checkout", "--quiet", version); err != nil {
+		return err
+	}
+	if version == "HEAD" || version == "origin/HEAD" {
+		described, err := r.git("describe", "--tags", "--always")
+		if err != nil {
+			return err
+		}
+		version = described
+	}
+	r.Version = version
+	return r.SaveMetadata()
+}
+
+// git runs a git command in the repository and returns its trimmed output.
+func (r *Repository) git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", r.Dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepo clones a local bare git repository with the tags v1.0.0 and v1.1.0 into a packs
+// home, and returns the packs home and the bare repository.
+func newTestRepo(t *testing.T) (home, origin string, cleanup func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(tmp) }
+
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			cleanup()
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	origin = filepath.Join(tmp, "origin.git")
+	work := filepath.Join(tmp, "work")
+	git(tmp, "init", "--quiet", "--bare", origin)
+	git(tmp, "clone", "--quiet", origin, work)
+	write(filepath.Join(work, "packs", "go", "main.go"), "package main\n")
+	git(work, "add", ".")
+	git(work, "commit", "--quiet", "-m", "add go pack")
+	git(work, "tag", "v1.0.0")
+	write(filepath.Join(work, "packs", "python", "app.py"), "print('hello')\n")
+	git(work, "add", ".")
+	git(work, "commit", "--quiet", "-m", "add python pack")
+	git(work, "tag", "v1.1.0")
+	git(work, "push", "--quiet", "--tags", "origin", "HEAD")
+
+	home = filepath.Join(tmp, "packs")
+	git(tmp, "clone", "--quiet", origin, filepath.Join(home, "example.com", "packs"))
+	return home, origin, cleanup
+}
+
+func TestRepositoryVersion(t *testing.T) {
+	home, origin, cleanup := newTestRepo(t)
+	defer cleanup()
+
+	r, err := FindRepository(home, "example.com/packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Source != "" || r.Version != "" {
+		t.Errorf("expected a repository without metadata to have no source and version, got %q and %q", r.Source, r.Version)
+	}
+	r.Source = origin
+	if err := r.Checkout("v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Pack("python"); err != ErrPackNotFoundInRepo {
+		t.Errorf("expected python not to exist at v1.0.0, got %v", err)
+	}
+
+	// the source and version are read back from the metadata file
+	r, err = FindRepository(home, "example.com/packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Source != origin || r.Version != "v1.0.0" {
+		t.Errorf("expected source %s at v1.0.0, got %s at %s", origin, r.Source, r.Version)
+	}
+	if dirty, err := r.IsDirty(); err != nil || dirty {
+		t.Errorf("expected a clean repository, got dirty=%v, err=%v", dirty, err)
+	}
+
+	if err := r.Checkout("v9.9.9"); err != ErrVersionDoesNotExist {
+		t.Errorf("expected ErrVersionDoesNotExist, got %v", err)
+	}
+	if err := r.Checkout("--orphan=evil"); err == nil {
+		t.Error("expected an error for a version starting with \"-\"")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(r.Dir, "packs", "go", "main.go"), []byte("package foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if dirty, err := r.IsDirty(); err != nil || !dirty {
+		t.Errorf("expected a dirty repository, got dirty=%v, err=%v", dirty, err)
+	}
+	if err := r.Checkout("v1.1.0"); err != ErrRepoDirty {
+		t.Errorf("expected ErrRepoDirty, got %v", err)
+	}
+}
+
+func TestFindRepositoryErrors(t *testing.T) {
+	if _, err := FindRepository(filepath.Join("testdata", "missing"), "github.com/testOrg1/testRepo1"); err != ErrHomeMissing {
+		t.Errorf("expected ErrHomeMissing, got %v", err)
+	}
+	if _, err := FindRepository(filepath.Join("testdata", "packs"), "github.com/testOrg1/missing"); err != ErrDoesNotExist {
+		t.Errorf("expected ErrDoesNotExist, got %v", err)
+	}
+
+	r, err := FindRepository(filepath.Join("testdata", "packs"), "github.com/testOrg1/testRepo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.IsDirty(); err != ErrMissingSource {
+		t.Errorf("expected ErrMissingSource for a repository that is not a git checkout, got %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package repo
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scpLikeURL matches git URLs in the scp-like syntax, e.g. git@github.com:org/repo.git.
+var scpLikeURL = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):([^/].*)$`)
+
+// NameFromSource returns the name a repository installed from source is installed under, in
+// the form <host>/<org>/<repo>. Repositories installed from a local directory or a file:// URL
+// use "local" as their host.
+func NameFromSource(source string) (string, error) {
+	host, p := "local", ""
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" && u.Scheme != "file" && len(u.Scheme) > 1 {
+		host, p = u.Hostname(), u.Path
+	} else if m := scpLikeURL.FindStringSubmatch(source); m != nil && !isLocal(source) {
+		host, p = m[1], m[2]
+	} else {
+		p = filepath.ToSlash(localPath(source))
+	}
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	parts := strings.Split(p, "/")
+	if host == "" || len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", fmt.Errorf("cannot derive a <host>/<org>/<repo> name from %q", source)
+	}
+	return path.Join(host, parts[len(parts)-2], parts[len(parts)-1]), nil
+}
+
+// Add installs the repository at source in home under the name returned by NameFromSource.
+//
+// Git repositories, given by URL or as a local directory with a .git directory, are cloned and
+// checked out at version, or at their default branch if version is empty. Other local
+// directories are copied, and version must be empty. Archives must be added with AddArchive to
+// be verified. It returns ErrExists if a repository with the same name is already installed.
+// Sources starting with "-" are rejected, as git would read them as options.
+func Add(home, source, version string) (*Repository, error) {
+	if strings.HasPrefix(source, "-") {
+		return nil, fmt.Errorf("invalid source %q: sources cannot start with \"-\"", source)
+	}
+	if IsArchive(source) {
+		return AddArchive(home, source, version, Verification{})
+	}
+	name, err := NameFromSource(source)
+	if err != nil {
+		return nil, err
+	}
+	// local sources are recorded as absolute paths so the repository can be updated from anywhere
+	if isLocal(source) && !strings.HasPrefix(source, "file://") {
+		if source, err = filepath.Abs(source); err != nil {
+			return nil, err
+		}
+	}
+	r := &Repository{
+		Name:   name,
+		Dir:    filepath.Join(home, filepath.FromSlash(name)),
+		Source: source,
+	}
+	if _, err := os.Stat(r.Dir); err == nil {
+		return nil, ErrExists
+	}
+	if err := r.install(version); err != nil {
+		os.RemoveAll(r.Dir)
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update reinstalls the repository from its source. Git repositories are fetched and checked
+// out at version, or at the latest commit of their default branch if version is empty.
+//
+// It returns ErrMissingSource if the repository's source is unknown, and ErrRepoDirty if a git
+// repository was modified since it was installed.
+func (r *Repository) Update(version string) error {
+	if r.Builtin {
+		return ErrBuiltin
+	}
+	if r.Source == "" {
+		return ErrMissingSource
+	}
+	if IsArchive(r.Source) {
+		return fmt.Errorf("pack repo %s was installed from an archive: remove it and add the new archive instead", r.Name)
+	}
+	if !isGitSource(r.Source) {
+		if version != "" {
+			return fmt.Errorf("pack repo %s is not a git repository and cannot be checked out at version %s", r.Name, version)
+		}
+		tmp := r.Dir + ".update"
+		os.RemoveAll(tmp)
+		if err := copyDir(localPath(r.Source), tmp); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		// the installed copy is kept until the new one is in place, so a failure loses nothing
+		old := r.Dir + ".old"
+		os.RemoveAll(old)
+		if err := os.Rename(r.Dir, old); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, r.Dir); err != nil {
+			os.Rename(old, r.Dir)
+			os.RemoveAll(tmp)
+			return err
+		}
+		os.RemoveAll(old)
+		return r.SaveMetadata()
+	}
+
+	dirty, err := r.IsDirty()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return ErrRepoDirty
+	}
+	if _, err := r.git("fetch", "--quiet", "--tags", "origin"); err != nil {
+		return err
+	}
+	if version == "" {
+		version = "origin/HEAD"
+	}
+	return r.checkout(version)
+}
+
+// Remove removes the repository with the given name from home, along with the directories
+// containing it that are left empty.
+func Remove(home, name string) error {
+	r, err := FindRepository(home, name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(r.Dir); err != nil {
+		return err
+	}
+	for dir := filepath.Dir(r.Dir); dir != filepath.Clean(home); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// install installs the repository from its source into its directory.
+func (r *Repository) install(version string) error {
+	if err := os.MkdirAll(filepath.Dir(r.Dir), 0755); err != nil {
+		return err
+	}
+	if isGitSource(r.Source) {
+		if _, err := (&Repository{Dir: filepath.Dir(r.Dir)}).git("clone", "--quiet", "--", r.Source, r.Dir); err != nil {
+			return err
+		}
+		if version == "" {
+			version = "HEAD"
+		}
+		if err := r.checkout(version); err != nil {
+			return err
+		}
+	} else {
+		if version != "" {
+			return fmt.Errorf("%s is not a git repository and cannot be checked out at version %s", r.Source, version)
+		}
+		if err := copyDir(localPath(r.Source), r.Dir); err != nil {
+			return err
+		}
+		if err := r.SaveMetadata(); err != nil {
+			return err
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(r.Dir, PackDirName)); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s is not a pack repo: it has no %s directory", r.Source, PackDirName)
+	}
+	return nil
+}
+
+// isGitSource reports whether source is a git URL or a local git repository.
+func isGitSource(source string) bool {
+	if isLocal(source) {
+		_, err := os.Stat(filepath.Join(localPath(source), ".git"))
+		return err == nil || strings.HasSuffix(source, ".git")
+	}
+	return true
+}
+
+// isLocal reports whether source is a local path or a file:// URL.
+func isLocal(source string) bool {
+	if strings.HasPrefix(source, "file://") {
+		return true
+	}
+	if u, err := url.Parse(source); err == nil && len(u.Scheme) > 1 {
+		return false
+	}
+	if scpLikeURL.MatchString(source) {
+		_, err := os.Stat(source)
+		return err == nil
+	}
+	return true
+}
+
+// localPath returns the path of a local source.
+func localPath(source string) string {
+	return filepath.FromSlash(strings.TrimPrefix(source, "file://"))
+}
+
+// copyDir copies the directory tree at src to dest, preserving file modes and symlinks. Symlinks
+// must resolve inside src without going through another symlink.
+func copyDir(src, dest string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", src)
+	}
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, fi.Mode().Perm())
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			linkname, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if inside, err := resolvesInside(src, rel, linkname); err != nil {
+				return err
+			} else if !inside {
+				return fmt.Errorf("symlink %s points outside of the repository: %s", rel, linkname)
+			}
+			return os.Symlink(linkname, target)
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target, fi.Mode().Perm())
+	})
+}
+
+func copyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,198 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNameFromSource(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"https://github.com/kubed/packs", "github.com/kubed/packs"},
+		{"https://github.com/kubed/packs.git", "github.com/kubed/packs"},
+		{"ssh://git@example.com:2222/org/repo.git/", "example.com/org/repo"},
+		{"git@github.com:kubed/packs.git", "github.com/kubed/packs"},
+		{"file:///srv/git/kubed/packs.git", "local/kubed/packs"},
+		{"/home/me/kubed/packs", "local/kubed/packs"},
+	}
+	for _, tt := range tests {
+		got, err := NameFromSource(tt.source)
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.source, tt.want, got)
+		}
+	}
+	if _, err := NameFromSource("https://github.com/packs"); err == nil {
+		t.Error("expected an error for a source without an org")
+	}
+}
+
+func TestAddUpdateRemoveGit(t *testing.T) {
+	home, origin, cleanup := newTestRepo(t)
+	defer cleanup()
+
+	source := "file://" + filepath.ToSlash(origin)
+	r, err := Add(home, source, "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, "local", filepath.Base(filepath.Dir(origin)), "origin"); r.Dir != want {
+		t.Errorf("expected the repository to be installed at %s, got %s", want, r.Dir)
+	}
+	installed, err := FindRepository(home, r.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed.Source != source || installed.Version != "v1.0.0" {
+		t.Errorf("expected %s at v1.0.0, got %s at %s", source, installed.Source, installed.Version)
+	}
+	if _, err := installed.Pack("python"); err != ErrPackNotFoundInRepo {
+		t.Errorf("expected python not to exist at v1.0.0, got %v", err)
+	}
+
+	if _, err := Add(home, source, ""); err != ErrExists {
+		t.Errorf("expected ErrExists adding the repository twice, got %v", err)
+	}
+
+	evil := filepath.Join(home, "evil")
+	if _, err := Add(home, "--upload-pack=touch "+evil+";git-upload-pack", ""); err == nil {
+		t.Error("expected an error for a source starting with -")
+	}
+	if _, err := os.Stat(evil); !os.IsNotExist(err) {
+		t.Errorf("expected the source not to be read as an option, got %v", err)
+	}
+	// a source recorded in the repository metadata is passed to git as a repository
+	if err := os.Symlink(origin, filepath.Join(home, "-origin.git")); err != nil {
+		t.Fatal(err)
+	}
+	dashed := &Repository{Dir: filepath.Join(home, "dashed"), Source: "-origin.git"}
+	if err := dashed.install(""); err != nil {
+		t.Errorf("expected a source starting with - to be cloned as a repository, got %v", err)
+	}
+	os.RemoveAll(dashed.Dir)
+	os.Remove(filepath.Join(home, "-origin.git"))
+
+	if err := installed.Update(""); err != nil {
+		t.Fatal(err)
+	}
+	if installed.Version != "v1.1.0" {
+		t.Errorf("expected the repository to be updated to v1.1.0, got %s", installed.Version)
+	}
+	if _, err := installed.Pack("python"); err != nil {
+		t.Errorf("expected python to exist after updating: %v", err)
+	}
+
+	if err := Remove(home, r.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "local")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty parent directories to be removed, got %v", err)
+	}
+	if err := Remove(home, r.Name); err != ErrDoesNotExist {
+		t.Errorf("expected ErrDoesNotExist removing the repository twice, got %v", err)
+	}
+}
+
+func TestAddLocalDirectory(t *testing.T) {
+	home, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	r, err := Add(home, filepath.Join("testdata", "packs", "github.com", "testOrg1", "testRepo1"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "local/testOrg1/testRepo1" {
+		t.Errorf("expected local/testOrg1/testRepo1, got %s", r.Name)
+	}
+	packs, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) != 2 {
+		t.Errorf("expected the repository's 2 packs to be copied, got %v", packs)
+	}
+	if err := r.Update(""); err != nil {
+		t.Errorf("expected a local directory to be updated by copying it again: %v", err)
+	}
+	for _, leftover := range []string{r.Dir + ".old", r.Dir + ".update"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed after the update, got %v", leftover, err)
+		}
+	}
+	if err := r.Update("v1.0.0"); err == nil {
+		t.Error("expected an error checking out a version of a local directory")
+	}
+
+	if _, err := Add(home, filepath.Join("testdata", "packs", "github.com", "testOrg1"), ""); err == nil {
+		t.Error("expected an error adding a directory without a packs directory")
+	}
+	if _, err := os.Stat(filepath.Join(home, "local", "github.com", "testOrg1")); !os.IsNotExist(err) {
+		t.Errorf("expected a failed installation to be cleaned up, got %v", err)
+	}
+}
+
+func TestCopyDirPreservesModesAndSymlinks(t *testing.T) {
+	src, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dest, err := ioutil.TempDir("", "pack-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	if err := os.MkdirAll(filepath.Join(src, "packs", "go", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "packs", "go", "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("run.sh", filepath.Join(src, "packs", "go", "start.sh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyDir(src, filepath.Join(dest, "copy")); err != nil {
+		t.Fatal(err)
+	}
+	pack := filepath.Join(dest, "copy", "packs", "go")
+	if fi, err := os.Stat(filepath.Join(pack, "run.sh")); err != nil || fi.Mode()&0111 == 0 {
+		t.Errorf("expected run.sh to stay executable, got %v, %v", fi, err)
+	}
+	if target, err := os.Readlink(filepath.Join(pack, "start.sh")); err != nil || target != "run.sh" {
+		t.Errorf("expected start.sh to be copied as a symlink to run.sh, got %q, %v", target, err)
+	}
+	if fi, err := os.Stat(filepath.Join(pack, "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("expected the empty directory to be copied, got %v", err)
+	}
+
+	escape := filepath.Join(src, "packs", "go", "escape")
+	if err := os.Symlink("../../../outside", escape); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyDir(src, filepath.Join(dest, "rejected")); err == nil {
+		t.Error("expected a symlink pointing outside of the repository to be rejected")
+	}
+	// each symlink stays inside the repository as text, but escape resolves to its parent
+	// through s
+	os.Remove(escape)
+	if err := os.Symlink("../..", filepath.Join(src, "packs", "s")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../s/../..", escape); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyDir(src, filepath.Join(dest, "chained")); err == nil {
+		t.Error("expected a symlink resolving outside of the repository through another one to be rejected")
+	}
+}
@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// MetadataFileName is the name of the file at the root of a pack repo recording where it was
+// installed from.
+const MetadataFileName = "repo.toml"
+
+// metadata is the content of a pack repo's metadata file.
+type metadata struct {
+	Source  string `toml:"source"`
+	Version string `toml:"version"`
+}
+
+// loadMetadata sets the source and version of the repository from its metadata file. It
+// returns ErrMissingSource if the repository has no metadata file.
+func (r *Repository) loadMetadata() error {
+	var m metadata
+	path := filepath.Join(r.Dir, MetadataFileName)
+	b, err := r.FS().ReadFile(path)
+	if os.IsNotExist(err) {
+		return ErrMissingSource
+	} else if err != nil {
+		return fmt.Errorf("error reading %s: %s", path, err)
+	}
+	if _, err := toml.Decode(string(b), &m); err != nil {
+		return fmt.Errorf("error reading %s: %s", path, err)
+	}
+	r.Source, r.Version = m.Source, m.Version
+	return nil
+}
+
+// SaveMetadata records the source and version of the repository in its metadata file.
+func (r *Repository) SaveMetadata() error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(metadata{Source: r.Source, Version: r.Version}); err != nil {
+		return err
+	}
+	return r.FS().WriteFile(filepath.Join(r.Dir, MetadataFileName), buf.Bytes(), 0644)
+}
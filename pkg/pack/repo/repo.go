@@ -3,10 +3,15 @@ package repo
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
 )
 
 // ErrPackNotFoundInRepo is the error returned when a pack is not found in a pack repo
@@ -15,48 +20,139 @@ var ErrPackNotFoundInRepo = errors.New("pack not found in pack repo")
 // PackDirName is name for the packs directory
 const PackDirName = "packs"
 
+// BuiltinName is the name of the repository holding the packs bundled with the generator.
+const BuiltinName = "default"
+
+// Builtin holds the packs bundled with the generator, one directory per pack. They are served as
+// the repository named BuiltinName, with the lowest precedence, unless a repository of that name
+// is installed. It is nil if no packs are bundled.
+var Builtin fs.FS
+
 // Repository represents a pack repository.
 type Repository struct {
 	Name string
 	Dir  string
+	// Source is where the repository was installed from, e.g. a git URL. It is empty if the
+	// repository has no metadata file.
+	Source string
+	// Version is the version of the repository that is installed, e.g. a git tag or commit. It
+	// is empty if the repository has no metadata file.
+	Version string
+	// Builtin is true for the repository of the packs bundled with the generator, which is not
+	// installed on disk.
+	Builtin bool
+	// fsys is the file system the repository is read from. It is nil for repositories on disk.
+	fsys vfs.FS
+}
+
+// FS returns the file system the repository is read from.
+func (r *Repository) FS() vfs.FS {
+	if r.fsys == nil {
+		return vfs.OS
+	}
+	return r.fsys
 }
 
 // FindRepositories takes a given path and returns a list of repositories.
 //
-// Repositories are defined as directories with a "packs" directory present.
+// Repositories are defined as directories with a "packs" directory present. Their source and
+// version are read from their metadata file; repositories whose metadata file is missing or
+// cannot be read have an empty Source and Version.
+//
+// The repository of the bundled packs comes last, unless a repository named BuiltinName is
+// installed in path.
 func FindRepositories(path string) []Repository {
+	repos := FindRepositoriesFS(vfs.OS, path)
+	if Builtin == nil || (len(repos) > 0 && repos[len(repos)-1].Name == BuiltinName) {
+		return repos
+	}
+	return append(repos, Repository{
+		Name:    BuiltinName,
+		Dir:     filepath.Join(path, BuiltinName),
+		Builtin: true,
+		fsys:    WithBuiltin(vfs.OS, path),
+	})
+}
+
+// WithBuiltin returns fsys with the bundled packs served as the repository named BuiltinName in
+// path, unless fsys already holds a repository of that name or no packs are bundled.
+func WithBuiltin(fsys vfs.FS, path string) vfs.FS {
+	if Builtin == nil {
+		return fsys
+	}
+	dir := filepath.Join(path, BuiltinName)
+	if _, err := fsys.Stat(dir); err == nil {
+		return fsys
+	}
+	return vfs.Mount(fsys, filepath.Join(dir, PackDirName), Builtin)
+}
+
+// FindRepositoriesFS is like FindRepositories, but finds the repositories in fsys, which does
+// not serve the bundled packs unless it comes from WithBuiltin. The repository named BuiltinName
+// comes last, as it has the lowest precedence.
+func FindRepositoriesFS(fsys vfs.FS, path string) []Repository {
 	var repos []Repository
 	// fail fast if directory does not exist
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	if _, err := fsys.Stat(path); os.IsNotExist(err) {
 		return repos
 	}
-	filepath.Walk(path, func(walkPath string, f os.FileInfo, err error) error {
+	fs.WalkDir(fsys, path, func(walkPath string, d fs.DirEntry, err error) error {
 		// find all directories in walkPath that have a child directory called "packs"
-		fileInfo, err := os.Stat(filepath.Join(walkPath, PackDirName))
+		fileInfo, err := fsys.Stat(filepath.Join(walkPath, PackDirName))
 		if err != nil {
 			return nil
 		}
 		if fileInfo.IsDir() {
-			repos = append(repos, Repository{
+			repo := Repository{
 				Name: filepath.ToSlash(strings.TrimPrefix(walkPath, path+string(os.PathSeparator))),
 				Dir:  walkPath,
-			})
+				fsys: fsys,
+			}
+			if err := repo.loadMetadata(); err != nil && err != ErrMissingSource {
+				log.Debugf("could not read the metadata of pack repo %s: %v", repo.Name, err)
+			}
+			repos = append(repos, repo)
 		}
 		return nil
 	})
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].Name != BuiltinName && repos[j].Name == BuiltinName
+	})
 	return repos
 }
 
+// FindRepository returns the repository with the given name in path.
+//
+// It returns ErrHomeMissing if path does not exist and ErrDoesNotExist if there is no such
+// repository.
+func FindRepository(path, name string) (*Repository, error) {
+	return FindRepositoryFS(vfs.OS, path, name)
+}
+
+// FindRepositoryFS is like FindRepository, but finds the repository in fsys.
+func FindRepositoryFS(fsys vfs.FS, path, name string) (*Repository, error) {
+	if _, err := fsys.Stat(path); os.IsNotExist(err) {
+		return nil, ErrHomeMissing
+	}
+	repos := FindRepositoriesFS(fsys, path)
+	for i := range repos {
+		if repos[i].Name == name {
+			return &repos[i], nil
+		}
+	}
+	return nil, ErrDoesNotExist
+}
+
 // Pack finds a packs with the given name in a repository and returns path
 func (r *Repository) Pack(name string) (string, error) {
 
 	//confirm repo exists
-	if _, err := os.Stat(r.Dir); os.IsNotExist(err) {
-		return "", fmt.Errorf("pack repo %s not found", r.Name)
+	if _, err := r.FS().Stat(r.Dir); os.IsNotExist(err) {
+		return "", ErrDoesNotExist
 	}
 
 	targetDir := filepath.Join(r.Dir, "packs", name)
-	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+	if _, err := r.FS().Stat(targetDir); os.IsNotExist(err) {
 		return "", ErrPackNotFoundInRepo
 	}
 
@@ -68,7 +164,7 @@ func (r *Repository) Pack(name string) (string, error) {
 // The returned pack names are prefixed by the repository name, e.g. "draft/go"
 func (r *Repository) List() ([]string, error) {
 	packsDir := filepath.Join(r.Dir, PackDirName)
-	switch fi, err := os.Stat(packsDir); {
+	switch fi, err := r.FS().Stat(packsDir); {
 	case err != nil:
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("pack repo %s packs directory not found", r.Name)
@@ -77,7 +173,7 @@ func (r *Repository) List() ([]string, error) {
 		return nil, fmt.Errorf("%s is not a directory", packsDir)
 	}
 	var packs []string
-	files, err := ioutil.ReadDir(packsDir)
+	files, err := r.FS().ReadDir(packsDir)
 	if err != nil {
 		return nil, err
 	}
@@ -1,8 +1,12 @@
 package repo
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"testing/fstest"
 )
 
 func TestPack(t *testing.T) {
@@ -33,3 +37,47 @@ func TestPackNotFound(t *testing.T) {
 		t.Error("Expected error, got no error")
 	}
 }
+
+func TestFindRepositoriesBuiltin(t *testing.T) {
+	Builtin = fstest.MapFS{
+		"go/Dockerfile": {Data: []byte("FROM golang\n")},
+	}
+	defer func() { Builtin = nil }()
+
+	home := filepath.Join("testdata", "packs")
+	repos := FindRepositories(home)
+	if len(repos) != 3 {
+		t.Fatalf("expected 2 installed pack repos and the bundled one, got %v", repos)
+	}
+	r := repos[2]
+	if r.Name != BuiltinName || !r.Builtin {
+		t.Fatalf("expected the bundled pack repo to come last, got %v", r)
+	}
+	packs, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"default/go"}; !reflect.DeepEqual(packs, want) {
+		t.Errorf("expected the bundled packs %v, got %v", want, packs)
+	}
+	if err := r.Update(""); err != ErrBuiltin {
+		t.Errorf("expected the bundled pack repo not to be updated, got %v", err)
+	}
+
+	// an installed repository of the same name replaces the bundled packs
+	dir, err := ioutil.TempDir("", "repo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, BuiltinName, PackDirName, "rust"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	repos = FindRepositories(dir)
+	if len(repos) != 1 || repos[0].Builtin {
+		t.Fatalf("expected only the installed pack repo, got %v", repos)
+	}
+	if packs, err := repos[0].List(); err != nil || !reflect.DeepEqual(packs, []string{"default/rust"}) {
+		t.Errorf("expected the installed packs, got %v, %v", packs, err)
+	}
+}
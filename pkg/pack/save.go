@@ -0,0 +1,321 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/vfs"
+)
+
+// OverwritePolicy is what is done with a pack file that already exists, with a different
+// content, in the directory the pack is saved to.
+type OverwritePolicy string
+
+const (
+	// Skip leaves the existing file untouched.
+	Skip OverwritePolicy = "skip"
+	// Overwrite replaces the existing file with the pack's.
+	Overwrite OverwritePolicy = "overwrite"
+	// Backup renames the existing file with BackupSuffix before writing the pack's. If that
+	// name is taken, a number is appended to it, as in "Dockerfile.bak.1".
+	Backup OverwritePolicy = "backup"
+	// MergePrompt asks what to do with each existing file, using SaveOptions.Prompt.
+	MergePrompt OverwritePolicy = "merge-prompt"
+	// Fail refuses to save the pack if any file already exists, without writing anything.
+	Fail OverwritePolicy = "fail"
+)
+
+// OverwritePolicies are the valid overwrite policies.
+var OverwritePolicies = []OverwritePolicy{Skip, Overwrite, Backup, MergePrompt, Fail}
+
+// BackupSuffix is appended to the name of files backed up by the Backup policy.
+const BackupSuffix = ".bak"
+
+// ParseOverwritePolicy parses the name of an overwrite policy.
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	for _, p := range OverwritePolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	names := make([]string, len(OverwritePolicies))
+	for i, p := range OverwritePolicies {
+		names[i] = string(p)
+	}
+	return "", fmt.Errorf("unknown overwrite policy %q: must be one of %s", s, strings.Join(names, ", "))
+}
+
+// PromptFunc asks what to do with the existing file at path, given its content and the
+// content of the pack's file. It returns Skip, Overwrite or Backup.
+type PromptFunc func(path string, existing, incoming []byte) (OverwritePolicy, error)
+
+// SaveOptions control how a pack is saved to a directory.
+type SaveOptions struct {
+	// Policy is what is done with existing files. It defaults to Skip.
+	Policy OverwritePolicy
+	// Prompt is used by the MergePrompt policy.
+	Prompt PromptFunc
+}
+
+// Resolve returns what is done with the existing file at path: Skip, Overwrite or Backup.
+func (o SaveOptions) Resolve(path string, existing, incoming []byte) (OverwritePolicy, error) {
+	switch o.Policy {
+	case "", Skip:
+		return Skip, nil
+	case Overwrite, Backup:
+		return o.Policy, nil
+	case Fail:
+		return "", &FileExistsError{Paths: []string{path}}
+	case MergePrompt:
+		if o.Prompt == nil {
+			return "", fmt.Errorf("cannot prompt what to do with %s", path)
+		}
+		action, err := o.Prompt(path, existing, incoming)
+		if err != nil {
+			return "", err
+		}
+		switch action {
+		case Skip, Overwrite, Backup:
+			return action, nil
+		}
+		return "", fmt.Errorf("invalid action %q for %s", action, path)
+	}
+	return "", fmt.Errorf("unknown overwrite policy %q", o.Policy)
+}
+
+// FileExistsError is returned by the Fail policy when pack files already exist.
+type FileExistsError struct {
+	Paths []string
+}
+
+func (e *FileExistsError) Error() string {
+	return fmt.Sprintf("refusing to overwrite existing files: %s", strings.Join(e.Paths, ", "))
+}
+
+// SaveReport lists what was done with each of the files of a pack that was saved. Paths are
+// the paths the files are saved at.
+type SaveReport struct {
+	// Created are the files that did not exist.
+	Created []string
+	// Unchanged are the files that already existed with the same content.
+	Unchanged []string
+	// Skipped are the files that already existed and were left untouched.
+	Skipped []string
+	// Overwritten are the files that already existed and were replaced.
+	Overwritten []string
+	// Backups are the paths existing files were backed up to before they were overwritten.
+	Backups []string
+}
+
+// Print prints the report, one file per line.
+func (r *SaveReport) Print(w io.Writer) {
+	for _, section := range []struct {
+		verb  string
+		paths []string
+	}{
+		{"created", r.Created},
+		{"skipped", r.Skipped},
+		{"overwritten", r.Overwritten},
+		{"backed up to", r.Backups},
+	} {
+		for _, p := range section.paths {
+			fmt.Fprintf(w, "%-13s %s\n", section.verb, p)
+		}
+	}
+}
+
+// SaveFS saves the pack as files in dest in fsys, handling existing files as set by opts, and
+// reports what was done with each file. File modes, symlinks and directories are reproduced; symlinks
+// are compared with existing files by their target.
+//
+// With the Fail policy, nothing is written if any file already exists with a different
+// content, and a *FileExistsError listing them is returned.
+func (p *Pack) SaveFS(fsys vfs.FS, dest string, opts SaveOptions) (*SaveReport, error) {
+	relPaths := make([]string, 0, len(p.Files))
+	contents := make(map[string][]byte, len(p.Files))
+	for relPath, f := range p.Files {
+		b, err := f.contents()
+		if err != nil {
+			return nil, err
+		}
+		relPaths = append(relPaths, relPath)
+		contents[relPath] = b
+	}
+	// parent directories sort before the entries they contain
+	sort.Strings(relPaths)
+
+	existing := make(map[string]*existingFile)
+	var conflicts []string
+	for _, relPath := range relPaths {
+		path := filepath.Join(dest, relPath)
+		e, err := readExisting(fsys, path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if e.dir != p.Files[relPath].IsDir() {
+			return nil, fmt.Errorf("%s already exists and is not a %s", path, p.Files[relPath].kind())
+		}
+		existing[relPath] = e
+		if !e.same(p.Files[relPath], contents[relPath]) {
+			conflicts = append(conflicts, path)
+		}
+	}
+	if opts.Policy == Fail && len(conflicts) > 0 {
+		return nil, &FileExistsError{Paths: conflicts}
+	}
+
+	report := new(SaveReport)
+	for _, relPath := range relPaths {
+		path := filepath.Join(dest, relPath)
+		f := p.Files[relPath]
+		e, exists := existing[relPath]
+		switch {
+		case f.IsDir():
+			if !exists {
+				if err := fsys.MkdirAll(path, f.Mode.Perm()); err != nil {
+					return report, fmt.Errorf("Error creating directory %v: %v", path, err)
+				}
+				if err := fsys.Chmod(path, f.Mode.Perm()); err != nil {
+					return report, err
+				}
+			}
+			continue
+		case !exists:
+			if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return report, fmt.Errorf("Error creating directory %v: %v", filepath.Dir(path), err)
+			}
+			report.Created = append(report.Created, path)
+		case e.same(f, contents[relPath]):
+			report.Unchanged = append(report.Unchanged, path)
+			continue
+		default:
+			action, err := opts.Resolve(path, e.content, contents[relPath])
+			if err != nil {
+				return report, err
+			}
+			if action == Skip {
+				report.Skipped = append(report.Skipped, path)
+				continue
+			}
+			if action == Backup {
+				backup, err := backupName(fsys, path, func(name string) bool {
+					rel, err := filepath.Rel(dest, name)
+					return err == nil && p.Files[rel] != nil
+				})
+				if err != nil {
+					return report, err
+				}
+				if err := fsys.Rename(path, backup); err != nil {
+					return report, err
+				}
+				report.Backups = append(report.Backups, backup)
+			} else if err := fsys.Remove(path); err != nil {
+				return report, err
+			}
+			report.Overwritten = append(report.Overwritten, path)
+		}
+		if err := writeFile(fsys, path, f, contents[relPath]); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// backupName returns the name the existing file at path in fsys is backed up to: path with
+// BackupSuffix, followed by the first number for which no file exists and taken returns false if
+// that name is used.
+func backupName(fsys vfs.FS, path string, taken func(name string) bool) (string, error) {
+	for i := 0; ; i++ {
+		name := path + BackupSuffix
+		if i > 0 {
+			name += "." + strconv.Itoa(i)
+		}
+		if taken(name) {
+			continue
+		}
+		if _, err := fsys.Lstat(name); os.IsNotExist(err) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// contents returns what an existing file is compared with: the content of a regular file or
+// the target of a symlink.
+func (f *File) contents() ([]byte, error) {
+	switch {
+	case f.IsSymlink():
+		return []byte(f.Target), nil
+	case f.IsDir():
+		return nil, nil
+	}
+	return f.ReadAll()
+}
+
+// kind describes the type of f in error messages.
+func (f *File) kind() string {
+	switch {
+	case f.IsDir():
+		return "directory"
+	case f.IsSymlink():
+		return "symlink"
+	}
+	return "file"
+}
+
+// existingFile is a file found where a pack file is saved.
+type existingFile struct {
+	dir     bool
+	symlink bool
+	// content is the content of a regular file, or the target of a symlink.
+	content []byte
+}
+
+// readExisting reads the file at path in fsys without following symlinks.
+func readExisting(fsys vfs.FS, path string) (*existingFile, error) {
+	fi, err := fsys.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &existingFile{dir: fi.IsDir(), symlink: fi.Mode()&os.ModeSymlink != 0}
+	switch {
+	case e.dir:
+	case e.symlink:
+		target, err := fsys.ReadLink(path)
+		if err != nil {
+			return nil, err
+		}
+		e.content = []byte(target)
+	default:
+		if e.content, err = fsys.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// same reports whether the existing file is the same type as f and has the same content.
+func (e *existingFile) same(f *File, content []byte) bool {
+	return e.dir == f.IsDir() && e.symlink == f.IsSymlink() && bytes.Equal(e.content, content)
+}
+
+// writeFile writes f to path in fsys with its mode, or creates it as a symlink.
+func writeFile(fsys vfs.FS, path string, f *File, content []byte) error {
+	if f.IsSymlink() {
+		return fsys.Symlink(f.Target, path)
+	}
+	if err := fsys.WriteFile(path, content, f.Mode.Perm()); err != nil {
+		return err
+	}
+	// set the mode explicitly, as the one given to WriteFile is masked by the umask
+	return fsys.Chmod(path, f.Mode.Perm())
+}
@@ -0,0 +1,88 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/manifest"
+)
+
+// TemplateSuffix is the suffix of pack files that are rendered as templates. It is removed from
+// the name of the rendered file.
+const TemplateSuffix = ".tmpl"
+
+// TemplateValues are the values pack templates are rendered with.
+type TemplateValues struct {
+	// Name is the name of the controller being generated.
+	Name string
+	// AppName is the name of the app the controller is part of.
+	AppName string
+	// Port is the port the controller listens on.
+	Port int
+	// EnvironmentName is the name of the environment the controller is generated for.
+	EnvironmentName string
+	// Environment is the configuration of the app for that environment.
+	Environment *manifest.Environment
+	// Vars are the values of the variables the pack accepts, as returned by
+	// Metadata.ResolveVariables.
+	Vars map[string]interface{}
+}
+
+// IsTemplate reports whether the pack file at relPath is rendered as a template: either its
+// name ends in TemplateSuffix or it matches one of the templates listed in the pack's metadata.
+func (p *Pack) IsTemplate(relPath string) bool {
+	if strings.HasSuffix(relPath, TemplateSuffix) {
+		return true
+	}
+	if p.Metadata == nil {
+		return false
+	}
+	for _, pattern := range p.Metadata.Templates {
+		if matched, _ := path.Match(pattern, filepath.ToSlash(relPath)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Render renders the pack's templates with values, replacing them in Files with the rendered
+// files, named without their TemplateSuffix. It returns an error if a rendered file would replace
+// another file of the pack.
+func (p *Pack) Render(values TemplateValues) error {
+	var templates []string
+	for relPath, f := range p.Files {
+		if f.IsRegular() && p.IsTemplate(relPath) {
+			templates = append(templates, relPath)
+		}
+	}
+	sort.Strings(templates)
+	for _, relPath := range templates {
+		name := strings.TrimSuffix(relPath, TemplateSuffix)
+		if _, ok := p.Files[name]; ok && name != relPath {
+			return fmt.Errorf("template %s renders to %s, which is already a file of the pack", relPath, name)
+		}
+	}
+	for _, relPath := range templates {
+		f := p.Files[relPath]
+		b, err := f.ReadAll()
+		delete(p.Files, relPath)
+		if err != nil {
+			return err
+		}
+		t, err := template.New(relPath).Option("missingkey=error").Parse(string(b))
+		if err != nil {
+			return fmt.Errorf("could not parse template %s: %v", relPath, err)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, values); err != nil {
+			return fmt.Errorf("could not render template %s: %v", relPath, err)
+		}
+		p.Files[strings.TrimSuffix(relPath, TemplateSuffix)] = BytesFile(f.Mode, buf.Bytes())
+	}
+	return nil
+}
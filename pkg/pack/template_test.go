@@ -0,0 +1,74 @@
+package pack
+
+import (
+	"testing"
+
+	"github.com/bacongobbler/kubed-generator-controller/pkg/manifest"
+)
+
+func TestRender(t *testing.T) {
+	p := &Pack{
+		Metadata: &Metadata{Templates: []string{"src/*.json"}},
+		Files: map[string]*File{
+			"Cargo.toml.tmpl":  BytesFile(0644, []byte(`name = "{{ .Name }}"`)),
+			"src/app.json":     BytesFile(0644, []byte(`{"app": "{{ .AppName }}", "port": {{ .Port }}, "env": "{{ .EnvironmentName }}", "ns": "{{ .Environment.Namespace }}"}`)),
+			"src/verbatim.txt": BytesFile(0644, []byte(`{{ .Name }}`)),
+		},
+	}
+	values := TemplateValues{
+		Name:            "users",
+		AppName:         "myapp",
+		Port:            3000,
+		EnvironmentName: "development",
+		Environment:     &manifest.Environment{Name: "myapp", Namespace: "default"},
+	}
+	if err := p.Render(values); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"Cargo.toml":       `name = "users"`,
+		"src/app.json":     `{"app": "myapp", "port": 3000, "env": "development", "ns": "default"}`,
+		"src/verbatim.txt": `{{ .Name }}`,
+	}
+	if len(p.Files) != len(want) {
+		t.Errorf("expected files %v, got %v", want, p.Files)
+	}
+	for name, content := range want {
+		f, ok := p.Files[name]
+		if !ok {
+			t.Errorf("expected %s to exist", name)
+			continue
+		}
+		b, err := f.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, b)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	for _, tpl := range []string{`{{ .Name `, `{{ .Missing }}`} {
+		p := &Pack{
+			Files: map[string]*File{
+				"main.go.tmpl": BytesFile(0644, []byte(tpl)),
+			},
+		}
+		if err := p.Render(TemplateValues{Name: "users"}); err == nil {
+			t.Errorf("expected an error rendering %q", tpl)
+		}
+	}
+
+	p := &Pack{
+		Files: map[string]*File{
+			"main.go":      BytesFile(0644, []byte("package main\n")),
+			"main.go.tmpl": BytesFile(0644, []byte("package {{ .Name }}\n")),
+		},
+	}
+	if err := p.Render(TemplateValues{Name: "users"}); err == nil {
+		t.Error("expected an error rendering a template over another file of the pack")
+	}
+}
@@ -0,0 +1,191 @@
+package pack
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The types of the variables a pack accepts.
+const (
+	VariableString = "string"
+	VariableInt    = "int"
+	VariableFloat  = "float"
+	VariableBool   = "bool"
+)
+
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Variable is a variable a pack accepts, declared in its pack.toml as
+//
+//	[variables.<name>]
+//	type = "int"
+//	default = 1
+//	description = "the number of workers"
+type Variable struct {
+	// Type is the type of the variable: string, int, float or bool. It defaults to string.
+	Type string `toml:"type"`
+	// Default is the value of the variable when none is given.
+	Default interface{} `toml:"default"`
+	// Required is whether a value must be given for the variable. Required variables have no
+	// default.
+	Required bool `toml:"required"`
+	// Description is a short description of the variable.
+	Description string `toml:"description"`
+}
+
+// RawValue is a variable value given as text, e.g. with --set, that is parsed according to the
+// type of the variable it is given for.
+type RawValue string
+
+// validateVariables checks the variable declarations of a pack.
+func validateVariables(vars map[string]Variable) error {
+	for _, name := range sortedVariables(vars) {
+		v := vars[name]
+		if !variableName.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		switch v.Type {
+		case "":
+			v.Type = VariableString
+			vars[name] = v
+		case VariableString, VariableInt, VariableFloat, VariableBool:
+		default:
+			return fmt.Errorf("variable %s has unknown type %q", name, v.Type)
+		}
+		if v.Default == nil {
+			continue
+		}
+		if v.Required {
+			return fmt.Errorf("variable %s is required and cannot have a default", name)
+		}
+		value, err := convertVariable(v.Type, v.Default)
+		if err != nil {
+			return fmt.Errorf("variable %s has an invalid default: %v", name, err)
+		}
+		v.Default = value
+		vars[name] = v
+	}
+	return nil
+}
+
+// ResolveVariables checks the given values against the variables the pack accepts and returns
+// the value of every variable, using the defaults of the variables no value is given for.
+// Optional variables without a default are set to the zero value of their type.
+//
+// Values given as a RawValue are parsed according to the variable's type, other values must
+// already be of that type. Every missing, unknown or mistyped value is reported in the error.
+func (m *Metadata) ResolveVariables(values map[string]interface{}) (map[string]interface{}, error) {
+	var problems []string
+	resolved := make(map[string]interface{}, len(m.Variables))
+	for _, name := range sortedVariables(m.Variables) {
+		v := m.Variables[name]
+		given, ok := values[name]
+		switch {
+		case ok:
+			value, err := convertVariable(v.Type, given)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			resolved[name] = value
+		case v.Required:
+			problems = append(problems, fmt.Sprintf("%s: a value is required", name))
+		case v.Default != nil:
+			resolved[name] = v.Default
+		default:
+			resolved[name], _ = convertVariable(v.Type, RawValue(""))
+		}
+	}
+	var unknown []string
+	for name := range values {
+		if _, ok := m.Variables[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("%s: the pack does not accept this variable", name))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid variables:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return resolved, nil
+}
+
+// convertVariable converts value to a variable of type typ.
+func convertVariable(typ string, value interface{}) (interface{}, error) {
+	if raw, ok := value.(RawValue); ok {
+		s := string(raw)
+		switch typ {
+		case VariableInt:
+			if s == "" {
+				return 0, nil
+			}
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("expected an int, got %q", s)
+			}
+			return i, nil
+		case VariableFloat:
+			if s == "" {
+				return 0.0, nil
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected a float, got %q", s)
+			}
+			return f, nil
+		case VariableBool:
+			if s == "" {
+				return false, nil
+			}
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("expected a bool, got %q", s)
+			}
+			return b, nil
+		default:
+			return s, nil
+		}
+	}
+
+	switch typ {
+	case VariableInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		}
+	case VariableFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case VariableBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	default:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of type %s, got %#v", typ, value)
+}
+
+func sortedVariables(vars map[string]Variable) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,118 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testVariables = `
+[variables.greeting]
+description = "what the app answers with"
+default = "hello"
+
+[variables.workers]
+type = "int"
+default = 2
+
+[variables.ratio]
+type = "float"
+
+[variables.debug]
+type = "bool"
+
+[variables.owner]
+required = true
+`
+
+func loadTestMetadata(t *testing.T, content string) (*Metadata, error) {
+	dir, err := ioutil.TempDir("", "pack-metadata-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, MetadataFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadMetadata(dir)
+}
+
+func TestResolveVariables(t *testing.T) {
+	m, err := loadTestMetadata(t, testVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Variables["greeting"].Type != VariableString {
+		t.Errorf("expected variables to default to type string, got %q", m.Variables["greeting"].Type)
+	}
+
+	got, err := m.ResolveVariables(map[string]interface{}{
+		"owner":   "team-a",
+		"workers": RawValue("4"),
+		"ratio":   1,
+		"debug":   RawValue("true"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"greeting": "hello",
+		"workers":  4,
+		"ratio":    1.0,
+		"debug":    true,
+		"owner":    "team-a",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	got, err = m.ResolveVariables(map[string]interface{}{"owner": RawValue("team-a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{"greeting": "hello", "workers": 2, "ratio": 0.0, "debug": false, "owner": "team-a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected defaults %v, got %v", want, got)
+	}
+}
+
+func TestResolveVariablesErrors(t *testing.T) {
+	m, err := loadTestMetadata(t, testVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.ResolveVariables(map[string]interface{}{
+		"workers": RawValue("many"),
+		"debug":   "yes",
+		"colour":  RawValue("blue"),
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`debug: expected a value of type bool, got "yes"`,
+		`owner: a value is required`,
+		`workers: expected an int, got "many"`,
+		`colour: the pack does not accept this variable`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to report %q, got\n%v", want, err)
+		}
+	}
+}
+
+func TestInvalidVariableDeclarations(t *testing.T) {
+	for _, content := range []string{
+		"[variables.workers]\ntype = \"integer\"\n",
+		"[variables.workers]\ntype = \"int\"\ndefault = \"two\"\n",
+		"[variables.workers]\nrequired = true\ndefault = \"two\"\n",
+		"[variables.\"worker-count\"]\n",
+	} {
+		if _, err := loadTestMetadata(t, content); err == nil {
+			t.Errorf("expected an error loading\n%s", content)
+		}
+	}
+}
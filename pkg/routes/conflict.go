@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflict is an existing route that conflicts with a route being added.
+type Conflict struct {
+	// Route is the existing route.
+	Route Route
+	// Line is the (1-indexed) line the existing route is on.
+	Line int
+	// Reason describes how the routes conflict.
+	Reason string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("line %d: %s (%s)", c.Line, strings.Join(strings.Fields(c.Route.String()), " "), c.Reason)
+}
+
+// ConflictError is returned when a route cannot be added because it conflicts with existing routes.
+type ConflictError struct {
+	// File is the path of the routes file.
+	File string
+	// Route is the route being added.
+	Route Route
+	// Conflicts are the existing routes it conflicts with.
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	lines := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		lines[i] = "\t" + c.String()
+	}
+	return fmt.Sprintf("route %s conflicts with existing routes in %s:\n%s", e.Route.Path, e.File, strings.Join(lines, "\n"))
+}
+
+// Conflicts returns the existing routes that would conflict with r if it was added with Add.
+//
+// A route conflicts with r if it has the same path, if it is matched before r and its path is
+// a prefix of r's path so that r is never reached, if r would be matched before it and shadow
+// it the same way, or if it forwards to the same backend.
+func (f *File) Conflicts(r Route) []Conflict {
+	var conflicts []Conflict
+	insertAt := f.insertionPoint()
+	for i, l := range f.Lines {
+		if l.Route == nil {
+			continue
+		}
+		existing := *l.Route
+		var reason string
+		switch {
+		case existing.Path == r.Path:
+			reason = "same path"
+		case i < insertAt && strings.HasPrefix(r.Path, existing.Path):
+			reason = fmt.Sprintf("shadows %s", r.Path)
+		case i >= insertAt && strings.HasPrefix(existing.Path, r.Path):
+			reason = fmt.Sprintf("shadowed by %s", r.Path)
+		case existing.Backend == r.Backend:
+			reason = fmt.Sprintf("same backend %s", r.Backend)
+		default:
+			continue
+		}
+		conflicts = append(conflicts, Conflict{Route: existing, Line: i + 1, Reason: reason})
+	}
+	return conflicts
+}
+
+// Contains reports whether the file already has a route with the same path, backend, port
+// and rewrite target as r.
+func (f *File) Contains(r Route) bool {
+	for _, existing := range f.Routes() {
+		if existing.String() == r.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"testing"
+)
+
+func TestConflicts(t *testing.T) {
+	f, err := Parse([]byte(`/api/	api	8080
+/web/users/	web	8080
+/	static	8080	/
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		route Route
+		want  []string
+	}{
+		{Route{Path: "/foo/", Backend: "foo", Port: 8080}, nil},
+		{Route{Path: "/api/", Backend: "api2", Port: 8080}, []string{"line 1: /api/ api 8080 (same path)"}},
+		{Route{Path: "/api/users/", Backend: "users", Port: 8080}, []string{"line 1: /api/ api 8080 (shadows /api/users/)"}},
+		{Route{Path: "/web/", Backend: "webfront", Port: 8080}, nil},
+		{Route{Path: "/foo/", Backend: "api", Port: 8080}, []string{"line 1: /api/ api 8080 (same backend api)"}},
+	}
+	for _, tt := range tests {
+		conflicts := f.Conflicts(tt.route)
+		if len(conflicts) != len(tt.want) {
+			t.Errorf("%s: expected %d conflicts, got %v", tt.route.Path, len(tt.want), conflicts)
+			continue
+		}
+		for i, c := range conflicts {
+			if c.String() != tt.want[i] {
+				t.Errorf("%s: expected conflict %q, got %q", tt.route.Path, tt.want[i], c.String())
+			}
+		}
+	}
+
+	// a route added above existing routes with a longer path shadows them
+	f, err = Parse([]byte("/\tstatic\t8080\t/\n/api/users/\tusers\t8080\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicts := f.Conflicts(Route{Path: "/api/", Backend: "api", Port: 8080})
+	if len(conflicts) != 1 || conflicts[0].String() != "line 2: /api/users/ users 8080 (shadowed by /api/)" {
+		t.Errorf("expected /api/users/ to be shadowed by /api/, got %v", conflicts)
+	}
+}
+
+func TestContains(t *testing.T) {
+	f, err := Parse([]byte("/api/ api 8080 # comment\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Contains(Route{Path: "/api/", Backend: "api", Port: 8080}) {
+		t.Error("expected the file to contain /api/")
+	}
+	if f.Contains(Route{Path: "/api/", Backend: "api", Port: 9090}) {
+		t.Error("expected the file to not contain /api/ on port 9090")
+	}
+}
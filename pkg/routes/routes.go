@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StaticRoute is the default route, serving the app's static files for every request that is
+// not matched by a route above it.
+var StaticRoute = Route{Path: "/", Backend: "static", Port: 8080, Rewrite: "/"}
+
+// Route is a single entry in a routes file, in the form
+//
+// <path> <backend> <port> [<rewrite>] [# <comment>]
+type Route struct {
+	// Path is the path prefix the route matches.
+	Path string
+	// Backend is the name of the service matching requests are forwarded to.
+	Backend string
+	// Port is the port the backend listens on.
+	Port int
+	// Rewrite is the path the matched prefix is rewritten to. It is empty if the path is
+	// forwarded as-is.
+	Rewrite string
+	// Comment is the comment at the end of the line, without the leading '#'.
+	Comment string
+}
+
+// String returns the route as it is written in a routes file, without its comment.
+func (r Route) String() string {
+	fields := []string{r.Path, r.Backend, strconv.Itoa(r.Port)}
+	if r.Rewrite != "" {
+		fields = append(fields, r.Rewrite)
+	}
+	return strings.Join(fields, "\t")
+}
+
+// IsDefault reports whether r is the default route serving static files.
+func (r Route) IsDefault() bool {
+	return r.Path == StaticRoute.Path && r.Backend == StaticRoute.Backend
+}
+
+// Line is a line in a routes file. Lines that do not hold a route are blank lines or comments.
+type Line struct {
+	// Route is the route on the line, or nil.
+	Route *Route
+	// raw is the line as it was parsed, including its line ending.
+	raw string
+	// parsed is the route as it was parsed, so that unchanged routes are written back as-is.
+	parsed Route
+}
+
+// text returns the line as it is written to a routes file.
+func (l *Line) text() string {
+	if l.Route == nil || *l.Route == l.parsed {
+		return l.raw
+	}
+	s := l.Route.String()
+	if l.Route.Comment != "" {
+		s += "\t#" + l.Route.Comment
+	}
+	return s + "\n"
+}
+
+// File is a parsed routes file.
+type File struct {
+	Lines []*Line
+}
+
+// Parse parses the content of a routes file.
+func Parse(content []byte) (*File, error) {
+	f := new(File)
+	lines := strings.SplitAfter(string(content), "\n")
+	for i, raw := range lines {
+		if raw == "" {
+			continue
+		}
+		line := &Line{raw: raw}
+		text := strings.TrimRight(raw, "\r\n")
+		var comment string
+		if j := strings.IndexByte(text, '#'); j >= 0 {
+			text, comment = text[:j], text[j+1:]
+		}
+		fields := strings.Fields(text)
+		if len(fields) > 0 {
+			r, err := parseRoute(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			r.Comment = comment
+			line.Route = &r
+			line.parsed = r
+		}
+		f.Lines = append(f.Lines, line)
+	}
+	return f, nil
+}
+
+func parseRoute(fields []string) (Route, error) {
+	if len(fields) < 3 || len(fields) > 4 {
+		return Route{}, fmt.Errorf("expected <path> <backend> <port> [<rewrite>], got %q", strings.Join(fields, " "))
+	}
+	r := Route{Path: fields[0], Backend: fields[1]}
+	if !strings.HasPrefix(r.Path, "/") {
+		return Route{}, fmt.Errorf("path %q must start with '/'", r.Path)
+	}
+	port, err := strconv.Atoi(fields[2])
+	if err != nil || port < 1 || port > 65535 {
+		return Route{}, fmt.Errorf("invalid port %q", fields[2])
+	}
+	r.Port = port
+	if len(fields) == 4 {
+		r.Rewrite = fields[3]
+	}
+	return r, nil
+}
+
+// Bytes returns the content of the routes file. Lines that were not modified since the file
+// was parsed are written back exactly as they were.
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+	for i, l := range f.Lines {
+		text := l.text()
+		if i < len(f.Lines)-1 && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		buf.WriteString(text)
+	}
+	return buf.Bytes()
+}
+
+// Routes returns the routes in the file, in order of precedence.
+func (f *File) Routes() []*Route {
+	var routes []*Route
+	for _, l := range f.Lines {
+		if l.Route != nil {
+			routes = append(routes, l.Route)
+		}
+	}
+	return routes
+}
+
+// Add adds a route above the default route, so that it takes higher priority than the static
+// files but lower priority than the routes above it. If there is no default route, the route
+// is added at the end of the file.
+func (f *File) Add(r Route) {
+	i := f.insertionPoint()
+	f.Lines = append(f.Lines, nil)
+	copy(f.Lines[i+1:], f.Lines[i:])
+	f.Lines[i] = &Line{Route: &r}
+}
+
+// insertionPoint returns the index of the line Add inserts a new route at.
+func (f *File) insertionPoint() int {
+	for i, l := range f.Lines {
+		if l.Route != nil && l.Route.IsDefault() {
+			return i
+		}
+	}
+	return len(f.Lines)
+}
+
+// Remove removes every route matching the predicate and returns the number of routes removed.
+func (f *File) Remove(match func(Route) bool) int {
+	var (
+		kept    []*Line
+		removed int
+	)
+	for _, l := range f.Lines {
+		if l.Route != nil && match(*l.Route) {
+			removed++
+			continue
+		}
+		kept = append(kept, l)
+	}
+	f.Lines = kept
+	return removed
+}
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testRoutes = "# routes are matched from top to bottom\n" +
+	"/api/   api     8080    # the public API\n" +
+	"\n" +
+	"/users/\tusers\t3000\t/\r\n" +
+	"/\tstatic\t8080\t/"
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(testRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Route{
+		{Path: "/api/", Backend: "api", Port: 8080, Comment: " the public API"},
+		{Path: "/users/", Backend: "users", Port: 3000, Rewrite: "/"},
+		{Path: "/", Backend: "static", Port: 8080, Rewrite: "/"},
+	}
+	if got := f.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if len(f.Lines) != 5 {
+		t.Errorf("expected 5 lines, got %d", len(f.Lines))
+	}
+	if got := string(f.Bytes()); got != testRoutes {
+		t.Errorf("expected an unmodified file to round-trip, got %q", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"/api/ api\n", `line 1: expected <path> <backend> <port> [<rewrite>], got "/api/ api"`},
+		{"# comment\napi api 8080\n", `line 2: path "api" must start with '/'`},
+		{"\n\n/api/ api http\n", `line 3: invalid port "http"`},
+		{"/api/ api 8080 / extra\n", `line 1: expected <path> <backend> <port> [<rewrite>], got "/api/ api 8080 / extra"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.content))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("expected error %q parsing %q, got %v", tt.want, tt.content, err)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	f, err := Parse([]byte(testRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Add(Route{Path: "/foo/", Backend: "foo", Port: 8080})
+	want := "# routes are matched from top to bottom\n" +
+		"/api/   api     8080    # the public API\n" +
+		"\n" +
+		"/users/\tusers\t3000\t/\r\n" +
+		"/foo/\tfoo\t8080\n" +
+		"/\tstatic\t8080\t/"
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// without a default route, routes are added at the end of the file
+	f, err = Parse([]byte("/api/ api 8080"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Add(Route{Path: "/foo/", Backend: "foo", Port: 8080})
+	if got, want := string(f.Bytes()), "/api/ api 8080\n/foo/\tfoo\t8080\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestModifyAndRemove(t *testing.T) {
+	f, err := Parse([]byte(testRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Routes()[0].Port = 9090
+	if n := f.Remove(func(r Route) bool { return r.Backend == "users" }); n != 1 {
+		t.Errorf("expected 1 route to be removed, got %d", n)
+	}
+	want := "# routes are matched from top to bottom\n" +
+		"/api/\tapi\t9090\t# the public API\n" +
+		"\n" +
+		"/\tstatic\t8080\t/"
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
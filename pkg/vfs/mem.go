@@ -0,0 +1,413 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errNotDir     = errors.New("not a directory")
+	errIsDir      = errors.New("is a directory")
+	errNotEmpty   = errors.New("directory not empty")
+	errNotSymlink = errors.New("not a symlink")
+)
+
+// MemFS is a file system kept in memory. It is safe for concurrent use.
+//
+// Absolute and relative names are both resolved from the root of the file system, so "a/b" and
+// "/a/b" name the same file.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+// memFile is a file, directory or symlink in a MemFS.
+type memFile struct {
+	mode    fs.FileMode
+	data    []byte
+	target  string
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS, holding only its root directory.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: map[string]*memFile{
+			"/": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+		},
+	}
+}
+
+// clean returns the key of the file with the given name.
+func clean(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+// resolve returns the key of the named file after following the symlinks in its directories,
+// and in the name itself if followLast is true, along with the file. The file is nil if it does
+// not exist but its directory does.
+func (m *MemFS) resolve(op, name string, followLast bool) (string, *memFile, error) {
+	p := "/"
+	rest := strings.Split(clean(name), "/")[1:]
+	links := 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		if elem == "" {
+			continue
+		}
+		next := path.Join(p, elem)
+		f, ok := m.files[next]
+		if !ok {
+			if len(rest) == 0 {
+				return next, nil, nil
+			}
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if f.mode&fs.ModeSymlink != 0 && (len(rest) > 0 || followLast) {
+			if links++; links > MaxSymlinks {
+				return "", nil, &fs.PathError{Op: op, Path: name, Err: ErrTooManyLinks}
+			}
+			target := f.target
+			if !path.IsAbs(target) {
+				target = path.Join(p, target)
+			}
+			rest = append(strings.Split(path.Clean(target), "/")[1:], rest...)
+			p = "/"
+			continue
+		}
+		if len(rest) > 0 && !f.mode.IsDir() {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+		p = next
+	}
+	return p, m.files[p], nil
+}
+
+// existing resolves the named file, returning an error if it does not exist.
+func (m *MemFS) existing(op, name string, followLast bool) (string, *memFile, error) {
+	key, f, err := m.resolve(op, name, followLast)
+	if err == nil && f == nil {
+		err = &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return key, f, err
+}
+
+// children returns the names of the files in the directory with the given key, sorted.
+func (m *MemFS) children(key string) []string {
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	var names []string
+	for k := range m.files {
+		if k != "/" && strings.HasPrefix(k, prefix) && !strings.Contains(k[len(prefix):], "/") {
+			names = append(names, k[len(prefix):])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the named file for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.existing("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	h := &memHandle{info: f.info(path.Base(key))}
+	if f.mode.IsDir() {
+		for _, child := range m.children(key) {
+			h.entries = append(h.entries, fs.FileInfoToDirEntry(m.files[path.Join(key, child)].info(child)))
+		}
+	} else {
+		h.Reader = bytes.NewReader(append([]byte{}, f.data...))
+	}
+	return h, nil
+}
+
+// Stat returns a FileInfo describing the named file, following symlinks.
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.existing("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return f.info(path.Base(key)), nil
+}
+
+// Lstat returns a FileInfo describing the named file, without following a final symlink.
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.existing("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return f.info(path.Base(key)), nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.existing("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	var entries []fs.DirEntry
+	for _, child := range m.children(key) {
+		entries = append(entries, fs.FileInfoToDirEntry(m.files[path.Join(key, child)].info(child)))
+	}
+	return entries, nil
+}
+
+// ReadFile returns the content of the named file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, f, err := m.existing("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return append([]byte{}, f.data...), nil
+}
+
+// ReadLink returns the target of the named symlink.
+func (m *MemFS) ReadLink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, f, err := m.existing("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if f.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotSymlink}
+	}
+	return f.target, nil
+}
+
+// WriteFile writes data to the named file, creating it with perm if necessary.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.resolve("open", name, true)
+	if err != nil {
+		return err
+	}
+	switch {
+	case f == nil:
+		m.files[key] = &memFile{mode: perm.Perm(), data: append([]byte{}, data...), modTime: time.Now()}
+	case f.mode.IsDir():
+		return &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	default:
+		f.data = append([]byte{}, data...)
+		f.modTime = time.Now()
+	}
+	return nil
+}
+
+// Mkdir creates the named directory with perm.
+func (m *MemFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	m.files[key] = &memFile{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+// MkdirAll creates the named directory with perm, along with any missing parents.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elems := strings.Split(clean(name), "/")
+	for i := 2; i <= len(elems); i++ {
+		dir := strings.Join(elems[:i], "/")
+		key, f, err := m.resolve("mkdir", dir, true)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			m.files[key] = &memFile{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+		} else if !f.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+		}
+	}
+	return nil
+}
+
+// Symlink creates newname as a symlink to oldname.
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		return &fs.PathError{Op: "symlink", Path: newname, Err: fs.ErrExist}
+	}
+	m.files[key] = &memFile{mode: fs.ModeSymlink | 0777, target: filepath.ToSlash(oldname), modTime: time.Now()}
+	return nil
+}
+
+// Rename renames oldname to newname, replacing newname if it already exists.
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldKey, f, err := m.existing("rename", oldname, false)
+	if err != nil {
+		return err
+	}
+	newKey, existing, err := m.resolve("rename", newname, false)
+	if err != nil {
+		return err
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	if f.mode.IsDir() && strings.HasPrefix(newKey, oldKey+"/") {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+	if existing != nil {
+		switch {
+		case existing.mode.IsDir() && !f.mode.IsDir():
+			return &fs.PathError{Op: "rename", Path: newname, Err: errIsDir}
+		case !existing.mode.IsDir() && f.mode.IsDir():
+			return &fs.PathError{Op: "rename", Path: newname, Err: errNotDir}
+		case existing.mode.IsDir() && len(m.children(newKey)) > 0:
+			return &fs.PathError{Op: "rename", Path: newname, Err: errNotEmpty}
+		}
+	}
+	for k, child := range m.files {
+		if strings.HasPrefix(k, oldKey+"/") {
+			delete(m.files, k)
+			m.files[newKey+k[len(oldKey):]] = child
+		}
+	}
+	delete(m.files, oldKey)
+	m.files[newKey] = f
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, f, err := m.existing("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if key == "/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if f.mode.IsDir() && len(m.children(key)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.files, key)
+	return nil
+}
+
+// Chmod changes the permission bits of the named file to those of mode.
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, f, err := m.existing("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	f.mode = f.mode&fs.ModeType | mode.Perm()
+	return nil
+}
+
+// info returns a FileInfo describing f under the given name.
+func (f *memFile) info(name string) fs.FileInfo {
+	size := int64(len(f.data))
+	if f.mode&fs.ModeSymlink != 0 {
+		size = int64(len(f.target))
+	}
+	return &memInfo{name: name, size: size, mode: f.mode, modTime: f.modTime}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() interface{}   { return nil }
+
+// NewHandle returns an open file described by info: a directory holding entries if info
+// describes one, or else a regular file holding a copy of data. It lets file systems built on top
+// of another implement Open.
+func NewHandle(info fs.FileInfo, data []byte, entries []fs.DirEntry) fs.File {
+	if info.IsDir() {
+		return &memHandle{info: info, entries: entries}
+	}
+	return &memHandle{info: info, Reader: bytes.NewReader(append([]byte{}, data...))}
+}
+
+// memHandle is an open file of a MemFS. It holds a copy of the content of a regular file, or
+// the entries of a directory.
+type memHandle struct {
+	*bytes.Reader
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (h *memHandle) Stat() (fs.FileInfo, error) {
+	return h.info, nil
+}
+
+func (h *memHandle) Read(b []byte) (int, error) {
+	if h.Reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: h.info.Name(), Err: errIsDir}
+	}
+	return h.Reader.Read(b)
+}
+
+func (h *memHandle) ReadDir(n int) ([]fs.DirEntry, error) {
+	if h.Reader != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: h.info.Name(), Err: errNotDir}
+	}
+	entries := h.entries[h.offset:]
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	h.offset += len(entries)
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+func (h *memHandle) Close() error {
+	return nil
+}
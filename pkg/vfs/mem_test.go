@@ -0,0 +1,109 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	if err := m.MkdirAll("app/src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteFile("app/src/main.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteFile("/app/run.sh", []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Symlink("src", "app/code"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Symlink("../run.sh", "app/src/run"); err != nil {
+		t.Fatal(err)
+	}
+	// MemFS accepts names io/fs does not, such as absolute ones, which fs.Sub rejects
+	app, err := fs.Sub(m, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(app, "src/main.go", "src/run", "run.sh"); err != nil {
+		t.Fatal(err)
+	}
+
+	// symlinks are followed in directories and, except by Lstat and ReadLink, in the name itself
+	if b, err := m.ReadFile("app/code/run"); err != nil || string(b) != "#!/bin/sh\n" {
+		t.Errorf("expected to read run.sh through symlinks, got %q, %v", b, err)
+	}
+	if fi, err := m.Lstat("app/code"); err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("expected app/code to be a symlink, got %v, %v", fi, err)
+	}
+	if target, err := m.ReadLink("/app/code"); err != nil || target != "src" {
+		t.Errorf("expected app/code to point to src, got %q, %v", target, err)
+	}
+	if fi, err := m.Stat("app/run.sh"); err != nil || fi.Mode() != 0755 {
+		t.Errorf("expected run.sh to have mode 0755, got %v, %v", fi, err)
+	}
+
+	if err := m.Rename("app/src", "app/lib"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stat("app/lib/main.go"); err != nil {
+		t.Errorf("expected the content of a renamed directory to move along, got %v", err)
+	}
+	if _, err := m.Stat("app/code"); !os.IsNotExist(err) {
+		t.Errorf("expected the symlink to the renamed directory to dangle, got %v", err)
+	}
+	if err := m.Remove("app/lib"); err == nil {
+		t.Error("expected an error removing a directory that is not empty")
+	}
+	if err := m.Remove("app/code"); err != nil {
+		t.Errorf("expected a dangling symlink to be removed, got %v", err)
+	}
+	entries, err := m.ReadDir("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"lib", "run.sh"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected entries %v, got %v", want, names)
+	}
+}
+
+func TestMemFSErrors(t *testing.T) {
+	m := NewMemFS()
+	if err := m.WriteFile("file", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Symlink("loop", "loop"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		op  string
+		err error
+	}{
+		{"read a missing file", func() error { _, err := m.ReadFile("missing"); return err }()},
+		{"write in a missing directory", m.WriteFile("missing/file", nil, 0644)},
+		{"write below a file", m.WriteFile("file/child", nil, 0644)},
+		{"create an existing directory", m.Mkdir("file", 0755)},
+		{"create a directory below a file", m.MkdirAll("file/child", 0755)},
+		{"read a directory", func() error { _, err := m.ReadFile("/"); return err }()},
+		{"follow a symlink loop", func() error { _, err := m.Stat("loop"); return err }()},
+		{"read a file as a symlink", func() error { _, err := m.ReadLink("file"); return err }()},
+		{"replace a file with a symlink", m.Symlink("target", "file")},
+	}
+	for _, tt := range tests {
+		if tt.err == nil {
+			t.Errorf("expected an error trying to %s", tt.op)
+		}
+	}
+	if _, err := m.ReadFile("missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file to be reported as not existing, got %v", err)
+	}
+}
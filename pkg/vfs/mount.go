@@ -0,0 +1,303 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mount returns a file system serving the files under dir from fsys, and the other files from
+// base. The files of fsys cannot be written to. The directories holding dir exist in the
+// returned file system even if they do not in base, and names are matched against dir as given,
+// so a file under dir must be named relative to the same directory as dir.
+//
+// Files of fsys are reported writable by their owner, so that they get their usual mode when
+// copied out of a read-only file system such as embed.FS, which reports every file read-only.
+func Mount(base FS, dir string, fsys fs.FS) FS {
+	return &mountFS{base: base, dir: filepath.Clean(dir), fsys: fsys}
+}
+
+type mountFS struct {
+	base FS
+	dir  string
+	fsys fs.FS
+}
+
+// sub returns the name in fsys of the named file, and whether it is under the mount point.
+func (m *mountFS) sub(name string) (string, bool) {
+	rel, err := filepath.Rel(m.dir, filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// holds returns the name of the entry of the named directory that leads to the mount point, if
+// the directory holds it.
+func (m *mountFS) holds(name string) (string, bool) {
+	name = filepath.Clean(name)
+	for d := m.dir; ; {
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", false
+		}
+		if parent == name {
+			return filepath.Base(d), true
+		}
+		d = parent
+	}
+}
+
+// mountError returns err with the name of the file in fsys replaced by name.
+func mountError(op, name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: op, Path: name, Err: pathErr.Err}
+	}
+	return err
+}
+
+// readOnly returns the error of op on a file under the mount point.
+func readOnly(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+}
+
+// Open opens the named file for reading.
+func (m *mountFS) Open(name string) (fs.File, error) {
+	if rel, ok := m.sub(name); ok {
+		f, err := m.fsys.Open(rel)
+		if err != nil {
+			return nil, mountError("open", name, err)
+		}
+		return mountFile{f, filepath.Base(name)}, nil
+	}
+	if _, ok := m.holds(name); ok {
+		info, err := m.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := m.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &memHandle{info: info, entries: entries}, nil
+	}
+	return m.base.Open(name)
+}
+
+// Stat returns a FileInfo describing the named file, following symlinks.
+func (m *mountFS) Stat(name string) (fs.FileInfo, error) {
+	if rel, ok := m.sub(name); ok {
+		fi, err := fs.Stat(m.fsys, rel)
+		if err != nil {
+			return nil, mountError("stat", name, err)
+		}
+		return mountInfo{fi, filepath.Base(name)}, nil
+	}
+	if _, ok := m.holds(name); ok {
+		if fi, err := m.base.Stat(name); err == nil && fi.IsDir() {
+			return fi, nil
+		}
+		return mountDirInfo(filepath.Base(name)), nil
+	}
+	return m.base.Stat(name)
+}
+
+// Lstat returns a FileInfo describing the named file, without following a final symlink. The
+// files under the mount point are described as Stat does.
+func (m *mountFS) Lstat(name string) (fs.FileInfo, error) {
+	if _, ok := m.sub(name); ok {
+		return m.Stat(name)
+	}
+	if _, ok := m.holds(name); ok {
+		return m.Stat(name)
+	}
+	return m.base.Lstat(name)
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (m *mountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if rel, ok := m.sub(name); ok {
+		entries, err := fs.ReadDir(m.fsys, rel)
+		if err != nil {
+			return nil, mountError("readdir", name, err)
+		}
+		for i, e := range entries {
+			entries[i] = writableEntry{e}
+		}
+		return entries, nil
+	}
+	child, ok := m.holds(name)
+	if !ok {
+		return m.base.ReadDir(name)
+	}
+	// the entry leading to the mount point shadows a file of the same name in base
+	info, err := m.Stat(filepath.Join(name, child))
+	if err != nil {
+		return nil, err
+	}
+	entries := []fs.DirEntry{fs.FileInfoToDirEntry(info)}
+	if baseEntries, err := m.base.ReadDir(name); err == nil {
+		for _, e := range baseEntries {
+			if e.Name() != child {
+				entries = append(entries, e)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ReadFile returns the content of the named file.
+func (m *mountFS) ReadFile(name string) ([]byte, error) {
+	if rel, ok := m.sub(name); ok {
+		b, err := fs.ReadFile(m.fsys, rel)
+		if err != nil {
+			return nil, mountError("open", name, err)
+		}
+		return b, nil
+	}
+	if _, ok := m.holds(name); ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return m.base.ReadFile(name)
+}
+
+// ReadLink returns the target of the named symlink. There are no symlinks under the mount point.
+func (m *mountFS) ReadLink(name string) (string, error) {
+	_, mounted := m.sub(name)
+	_, holds := m.holds(name)
+	if !mounted && !holds {
+		return m.base.ReadLink(name)
+	}
+	if _, err := m.Stat(name); err != nil {
+		return "", mountError("readlink", name, err)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotSymlink}
+}
+
+// WriteFile writes data to the named file, which must not be under the mount point.
+func (m *mountFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if _, ok := m.sub(name); ok {
+		return readOnly("open", name)
+	}
+	return m.base.WriteFile(name, data, perm)
+}
+
+// Mkdir creates the named directory, which must not be under the mount point.
+func (m *mountFS) Mkdir(name string, perm fs.FileMode) error {
+	if _, ok := m.sub(name); ok {
+		return readOnly("mkdir", name)
+	}
+	return m.base.Mkdir(name, perm)
+}
+
+// MkdirAll creates the named directory along with any missing parents. It fails if the directory
+// is under the mount point.
+func (m *mountFS) MkdirAll(name string, perm fs.FileMode) error {
+	if _, ok := m.sub(name); ok {
+		return readOnly("mkdir", name)
+	}
+	return m.base.MkdirAll(name, perm)
+}
+
+// Symlink creates newname as a symlink to oldname. newname must not be under the mount point.
+func (m *mountFS) Symlink(oldname, newname string) error {
+	if _, ok := m.sub(newname); ok {
+		return readOnly("symlink", newname)
+	}
+	return m.base.Symlink(oldname, newname)
+}
+
+// Rename renames oldname to newname. Neither can be under the mount point.
+func (m *mountFS) Rename(oldname, newname string) error {
+	if _, ok := m.sub(oldname); ok {
+		return readOnly("rename", oldname)
+	}
+	if _, ok := m.sub(newname); ok {
+		return readOnly("rename", newname)
+	}
+	return m.base.Rename(oldname, newname)
+}
+
+// Remove removes the named file or empty directory, which must not be under the mount point.
+func (m *mountFS) Remove(name string) error {
+	if _, ok := m.sub(name); ok {
+		return readOnly("remove", name)
+	}
+	return m.base.Remove(name)
+}
+
+// Chmod changes the mode of the named file, which must not be under the mount point.
+func (m *mountFS) Chmod(name string, mode fs.FileMode) error {
+	if _, ok := m.sub(name); ok {
+		return readOnly("chmod", name)
+	}
+	return m.base.Chmod(name, mode)
+}
+
+// mountInfo describes a file under the mount point, under the given name, as writable by its
+// owner.
+type mountInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i mountInfo) Name() string {
+	return i.name
+}
+
+func (i mountInfo) Mode() fs.FileMode {
+	return i.FileInfo.Mode() | 0200
+}
+
+type writableEntry struct {
+	fs.DirEntry
+}
+
+func (e writableEntry) Info() (fs.FileInfo, error) {
+	fi, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return mountInfo{fi, fi.Name()}, nil
+}
+
+// mountFile is an open file under the mount point, with the given name.
+type mountFile struct {
+	fs.File
+	name string
+}
+
+func (f mountFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return mountInfo{fi, f.name}, nil
+}
+
+func (f mountFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+	entries, err := dir.ReadDir(n)
+	for i, e := range entries {
+		entries[i] = writableEntry{e}
+	}
+	return entries, err
+}
+
+// mountDirInfo describes a directory holding the mount point that base does not have.
+type mountDirInfo string
+
+func (i mountDirInfo) Name() string       { return string(i) }
+func (i mountDirInfo) Size() int64        { return 0 }
+func (i mountDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (i mountDirInfo) ModTime() time.Time { return time.Time{} }
+func (i mountDirInfo) IsDir() bool        { return true }
+func (i mountDirInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,70 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMount(t *testing.T) {
+	base := NewMemFS()
+	if err := base.MkdirAll(filepath.Join("plugin", "packs", "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	packs := fstest.MapFS{
+		"go/Dockerfile": {Data: []byte("FROM golang\n"), Mode: 0444},
+		"go/pack.toml":  {Data: []byte("version = \"1.0.0\"\n"), Mode: 0444},
+	}
+	m := Mount(base, filepath.Join("plugin", "packs", "default", "packs"), packs)
+
+	plugin, err := fs.Sub(m, "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(plugin, "packs/default/packs/go/Dockerfile", "packs/other"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the directories holding the mount point are listed along with the ones of base
+	entries, err := m.ReadDir(filepath.Join("plugin", "packs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"default", "other"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected entries %v, got %v", want, names)
+	}
+	if fi, err := m.Stat(filepath.Join("plugin", "packs", "default")); err != nil || !fi.IsDir() {
+		t.Errorf("expected the directory holding the mount point to exist, got %v, %v", fi, err)
+	}
+
+	dockerfile := filepath.Join("plugin", "packs", "default", "packs", "go", "Dockerfile")
+	if b, err := m.ReadFile(dockerfile); err != nil || string(b) != "FROM golang\n" {
+		t.Errorf("expected to read the mounted Dockerfile, got %q, %v", b, err)
+	}
+	if fi, err := m.Stat(dockerfile); err != nil || fi.Mode() != 0644 {
+		t.Errorf("expected the mounted Dockerfile to be writable by its owner, got %v, %v", fi, err)
+	}
+	if err := m.WriteFile(dockerfile, []byte("FROM scratch\n"), 0644); !os.IsPermission(err) {
+		t.Errorf("expected the mounted files to be read-only, got %v", err)
+	}
+	if err := m.Remove(dockerfile); !os.IsPermission(err) {
+		t.Errorf("expected the mounted files to be read-only, got %v", err)
+	}
+	if _, err := m.Stat(filepath.Join("plugin", "packs", "default", "packs", "rust")); !os.IsNotExist(err) {
+		t.Errorf("expected a missing mounted file to not exist, got %v", err)
+	}
+
+	if err := m.WriteFile(filepath.Join("plugin", "packs", "other", "notes"), []byte("hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Stat(filepath.Join("plugin", "packs", "other", "notes")); err != nil {
+		t.Errorf("expected files outside of the mount point to be written to base, got %v", err)
+	}
+}
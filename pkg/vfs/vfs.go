@@ -0,0 +1,49 @@
+// Package vfs defines the file system the packs, pack repositories and generated projects are
+// read from and written to, so that they can be kept in memory instead of on disk.
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// MaxSymlinks is the number of symlinks followed while resolving a name before giving up with
+// ErrTooManyLinks, as on Linux.
+const MaxSymlinks = 40
+
+// ErrTooManyLinks is returned when resolving a name goes through more than MaxSymlinks symlinks,
+// as when symlinks point to each other in a loop.
+var ErrTooManyLinks = errors.New("too many levels of symbolic links")
+
+// FS is a file system that can be written to.
+//
+// Its read side implements the interfaces of the io/fs package, so that it can be used with
+// fs.WalkDir, fs.ReadFile and the like. Unlike with io/fs, names are file paths using the
+// separator of the operating system, and may be absolute.
+type FS interface {
+	fs.StatFS
+	fs.ReadDirFS
+	fs.ReadFileFS
+
+	// Lstat returns a FileInfo describing the named file. If the file is a symlink, the
+	// FileInfo describes the symlink instead of following it.
+	Lstat(name string) (fs.FileInfo, error)
+	// ReadLink returns the target of the named symlink. Together with Lstat, it implements
+	// fs.ReadLinkFS on the Go versions that have it.
+	ReadLink(name string) (string, error)
+
+	// WriteFile writes data to the named file, creating it with perm if necessary.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// Mkdir creates the named directory with perm.
+	Mkdir(name string, perm fs.FileMode) error
+	// MkdirAll creates the named directory with perm, along with any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Symlink creates newname as a symlink to oldname.
+	Symlink(oldname, newname string) error
+	// Rename renames oldname to newname, replacing newname if it already exists.
+	Rename(oldname, newname string) error
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+	// Chmod changes the permission bits of the named file to those of mode.
+	Chmod(name string, mode fs.FileMode) error
+}